@@ -0,0 +1,145 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+const karcherMaxIterations = 16
+
+// checkWeights panics unless weights is nil or has one weight per
+// quaternion
+func checkWeights(quats []Quaternion, weights []float32) {
+	if weights != nil && len(weights) != len(quats) {
+		panic("vmath: quaternion and weight counts do not match")
+	}
+}
+
+// quatWeight returns the weight of the ith rotation, with nil weights
+// counting every rotation equally
+func quatWeight(weights []float32, i int) float32 {
+	if weights == nil {
+		return 1.0
+	}
+	return weights[i]
+}
+
+// Average returns the weighted average rotation by Markley's method, the
+// eigenvector of largest eigenvalue of the sum of weighted outer products
+// of the quaternions.  It treats q and -q alike, needs no starting guess
+// and minimises the weighted squared chordal distance to the inputs.
+// weights may be nil to weight the quaternions equally, and otherwise must
+// be as long as quats.  The average of no rotations is the identity.
+func (result *Quaternion) Average(quats []Quaternion, weights []float32) {
+	checkWeights(quats, weights)
+	if len(quats) == 0 {
+		result.MakeIdentity()
+		return
+	}
+	var sum, vectors Matrix4
+	for i := range quats {
+		weight := quatWeight(weights, i)
+		for col := 0; col < 4; col++ {
+			for row := 0; row < 4; row++ {
+				sum[col*4+row] += weight * quats[i][row] * quats[i][col]
+			}
+		}
+	}
+	jacobiEigen(sum[:], vectors[:], 4)
+
+	best := 0
+	for i := 1; i < 4; i++ {
+		if sum[i*4+i] > sum[best*4+best] {
+			best = i
+		}
+	}
+	copy(result[:], vectors[best*4:best*4+4])
+	if result.Dot(&quats[0]) < 0.0 {
+		result.NegSelf()
+	}
+	result.NormalizeSelf()
+}
+
+// KarcherMean returns the weighted rotation that minimises the sum of
+// squared rotation angles to the inputs, the true geodesic mean.  It
+// starts from Average and iterates in the tangent space, so it costs
+// several times as much.  weights are as for Average.
+func (result *Quaternion) KarcherMean(quats []Quaternion, weights []float32) {
+	checkWeights(quats, weights)
+	result.Average(quats, weights)
+	if len(quats) == 0 {
+		return
+	}
+
+	for iter := 0; iter < karcherMaxIterations; iter++ {
+		var inv, rel, step Quaternion
+		var delta, tangent Vector3
+		total := float32(0.0)
+		inv.Conj(result)
+		for i := range quats {
+			weight := quatWeight(weights, i)
+			rel.Mul(&inv, &quats[i])
+			if rel[w] < 0.0 {
+				rel.NegSelf()
+			}
+			rel.log(&tangent)
+			tangent.ScalarMulSelf(weight)
+			delta.AddToSelf(&tangent)
+			total += weight
+		}
+		if total <= 0.0 {
+			return
+		}
+		delta.ScalarMulSelf(1.0 / total)
+		step.exp(&delta)
+		result.MulSelf(&step)
+		result.NormalizeSelf()
+		if delta.LengthSqr() < g_EPSILON*g_EPSILON {
+			return
+		}
+	}
+}
+
+// log returns half the rotation vector of the unit quaternion q
+func (q *Quaternion) log(result *Vector3) {
+	result[x], result[y], result[z] = q[x], q[y], q[z]
+	sinHalf := result.Length()
+	if sinHalf < g_EPSILON {
+		return
+	}
+	result.ScalarMulSelf(atan2(sinHalf, q[w]) / sinHalf)
+}
+
+// exp is the inverse of log
+func (result *Quaternion) exp(vec *Vector3) {
+	half := vec.Length()
+	scale := float32(1.0)
+	if half > g_EPSILON {
+		scale = sin(half) / half
+	}
+	result[x] = vec[x] * scale
+	result[y] = vec[y] * scale
+	result[z] = vec[z] * scale
+	result[w] = cos(half)
+}
+
+// NlerpBlend returns the normalized weighted sum of the quaternions, each
+// first flipped into the hemisphere of the sum so far so that q and -q
+// pull the same way.  It is the cheapest blend, and close to Average when
+// the rotations are near each other.  weights are as for Average.
+func (result *Quaternion) NlerpBlend(quats []Quaternion, weights []float32) {
+	checkWeights(quats, weights)
+	var sum, term Quaternion
+	for i := range quats {
+		term.ScalarMul(&quats[i], quatWeight(weights, i))
+		if sum.Dot(&term) < 0.0 {
+			sum.SubFromSelf(&term)
+		} else {
+			sum.AddToSelf(&term)
+		}
+	}
+	if sum.Norm() < g_EPSILON*g_EPSILON {
+		result.MakeIdentity()
+		return
+	}
+	result.Normalize(&sum)
+}
@@ -176,3 +176,39 @@ func BenchmarkArrayM3MulSelf(b *testing.B) {
 	}
 
 }
+
+func benchmarkQuaternions() (*Quaternion, *Quaternion) {
+	quat0 := &Quaternion{}
+	quat1 := &Quaternion{}
+	axis := &Vector3{0.6, 0, 0.8}
+	quat0.MakeRotationAxis(0.3, axis)
+	quat1.MakeRotationAxis(2.1, axis)
+	return quat0, quat1
+}
+
+func BenchmarkQuaternionSlerp(b *testing.B) {
+	quat0, quat1 := benchmarkQuaternions()
+	result := &Quaternion{}
+
+	for i := 0; i < b.N; i++ {
+		result.Slerp(float32(i&63)/63.0, quat0, quat1)
+	}
+}
+
+func BenchmarkQuaternionNlerp(b *testing.B) {
+	quat0, quat1 := benchmarkQuaternions()
+	result := &Quaternion{}
+
+	for i := 0; i < b.N; i++ {
+		result.Nlerp(float32(i&63)/63.0, quat0, quat1)
+	}
+}
+
+func BenchmarkQuaternionFastSlerp(b *testing.B) {
+	quat0, quat1 := benchmarkQuaternions()
+	result := &Quaternion{}
+
+	for i := 0; i < b.N; i++ {
+		result.FastSlerp(float32(i&63)/63.0, quat0, quat1)
+	}
+}
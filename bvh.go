@@ -0,0 +1,560 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+)
+
+// BVH is a bounding volume hierarchy over items identified by integer ids,
+// each with an AABB.  It can be built in one pass over a static set, and
+// items can then be inserted, removed and refit as they move.
+type BVH struct {
+	nodes  []bvhNode
+	root   int
+	free   int
+	leaves map[int]int
+}
+
+type bvhNode struct {
+	box         AABB
+	parent      int
+	left, right int
+	item        int
+}
+
+const bvhNull = -1
+
+const bvhBins = 12
+
+func (n *bvhNode) isLeaf() bool {
+	return n.left == bvhNull
+}
+
+func (b *BVH) reset() {
+	b.nodes = b.nodes[:0]
+	b.root = bvhNull
+	b.free = bvhNull
+	b.leaves = make(map[int]int)
+}
+
+func (b *BVH) allocNode() int {
+	if b.free != bvhNull {
+		n := b.free
+		b.free = b.nodes[n].parent
+		b.nodes[n] = bvhNode{parent: bvhNull, left: bvhNull, right: bvhNull, item: bvhNull}
+		return n
+	}
+	b.nodes = append(b.nodes, bvhNode{parent: bvhNull, left: bvhNull, right: bvhNull, item: bvhNull})
+	return len(b.nodes) - 1
+}
+
+func (b *BVH) freeNode(n int) {
+	b.nodes[n].parent = b.free
+	b.nodes[n].left = bvhNull
+	b.nodes[n].item = bvhNull
+	b.free = n
+}
+
+func (b *BVH) Len() int {
+	return len(b.leaves)
+}
+
+// empty also covers the zero value BVH, whose root hasn't been set
+func (b *BVH) empty() bool {
+	return len(b.leaves) == 0
+}
+
+// Build replaces the contents of the tree with boxes, top down, choosing
+// each split with the surface area heuristic.  Item ids are the indices
+// into boxes.
+func (b *BVH) Build(boxes []AABB) {
+	b.reset()
+	if len(boxes) == 0 {
+		return
+	}
+
+	items := make([]int, len(boxes))
+	centroids := make([]Point3, len(boxes))
+	for i := range boxes {
+		items[i] = i
+		boxes[i].Center(&centroids[i])
+	}
+	b.root = b.buildNode(boxes, centroids, items)
+	b.nodes[b.root].parent = bvhNull
+}
+
+func (b *BVH) buildNode(boxes []AABB, centroids []Point3, items []int) int {
+	n := b.allocNode()
+	if len(items) == 1 {
+		b.nodes[n].box = boxes[items[0]]
+		b.nodes[n].item = items[0]
+		b.leaves[items[0]] = n
+		return n
+	}
+
+	var bounds, centerBounds AABB
+	bounds = boxes[items[0]]
+	centerBounds.Min = centroids[items[0]]
+	centerBounds.Max = centroids[items[0]]
+	for _, item := range items[1:] {
+		bounds.UnionSelf(&boxes[item])
+		centerBounds.AddPoint(&centroids[item])
+	}
+	b.nodes[n].box = bounds
+
+	mid := bvhSplit(boxes, centroids, items, &centerBounds)
+
+	left := b.buildNode(boxes, centroids, items[:mid])
+	right := b.buildNode(boxes, centroids, items[mid:])
+	b.nodes[n].left = left
+	b.nodes[n].right = right
+	b.nodes[left].parent = n
+	b.nodes[right].parent = n
+	return n
+}
+
+// bvhSplit partitions items along the axis of greatest centroid spread at
+// the binned split with the lowest surface area cost, and returns the
+// index of the first item on the right
+func bvhSplit(boxes []AABB, centroids []Point3, items []int, centerBounds *AABB) int {
+	var extent Vector3
+	extent.P3Sub(&centerBounds.Max, &centerBounds.Min)
+	axis := 0
+	if extent[y] > extent[axis] {
+		axis = y
+	}
+	if extent[z] > extent[axis] {
+		axis = z
+	}
+	if extent[axis] <= g_EPSILON {
+		return len(items) / 2
+	}
+
+	var binBoxes [bvhBins]AABB
+	var binCounts [bvhBins]int
+	binOf := func(item int) int {
+		bin := int(bvhBins * (centroids[item][axis] - centerBounds.Min[axis]) / extent[axis])
+		if bin >= bvhBins {
+			bin = bvhBins - 1
+		}
+		return bin
+	}
+	for _, item := range items {
+		bin := binOf(item)
+		if binCounts[bin] == 0 {
+			binBoxes[bin] = boxes[item]
+		} else {
+			binBoxes[bin].UnionSelf(&boxes[item])
+		}
+		binCounts[bin]++
+	}
+
+	// sweep from the right to get the cost of everything past each split
+	var rightArea [bvhBins]float32
+	var rightCount [bvhBins]int
+	var acc AABB
+	count := 0
+	for i := bvhBins - 1; i > 0; i-- {
+		if binCounts[i] > 0 {
+			if count == 0 {
+				acc = binBoxes[i]
+			} else {
+				acc.UnionSelf(&binBoxes[i])
+			}
+			count += binCounts[i]
+		}
+		rightCount[i] = count
+		if count > 0 {
+			rightArea[i] = acc.SurfaceArea()
+		}
+	}
+
+	bestSplit := -1
+	bestCost := float32(math.MaxFloat32)
+	count = 0
+	for i := 0; i < bvhBins-1; i++ {
+		if binCounts[i] > 0 {
+			if count == 0 {
+				acc = binBoxes[i]
+			} else {
+				acc.UnionSelf(&binBoxes[i])
+			}
+			count += binCounts[i]
+		}
+		if count == 0 || rightCount[i+1] == 0 {
+			continue
+		}
+		cost := acc.SurfaceArea()*float32(count) + rightArea[i+1]*float32(rightCount[i+1])
+		if cost < bestCost {
+			bestCost = cost
+			bestSplit = i
+		}
+	}
+	if bestSplit < 0 {
+		return len(items) / 2
+	}
+
+	mid := 0
+	for i, item := range items {
+		if binOf(item) <= bestSplit {
+			items[i], items[mid] = items[mid], items[i]
+			mid++
+		}
+	}
+	return mid
+}
+
+// Insert adds an item, descending toward the sibling that grows the tree's
+// surface area the least
+func (b *BVH) Insert(item int, box *AABB) {
+	if b.leaves == nil {
+		b.reset()
+	}
+	if _, ok := b.leaves[item]; ok {
+		b.Remove(item)
+	}
+
+	leaf := b.allocNode()
+	b.nodes[leaf].box = *box
+	b.nodes[leaf].item = item
+	b.leaves[item] = leaf
+
+	if b.root == bvhNull {
+		b.root = leaf
+		return
+	}
+
+	var combined AABB
+	sibling := b.root
+	for !b.nodes[sibling].isLeaf() {
+		node := &b.nodes[sibling]
+		area := node.box.SurfaceArea()
+		combined.Union(&node.box, box)
+		combinedArea := combined.SurfaceArea()
+
+		// cost of making a new parent here, and the least cost increase
+		// of pushing the leaf down into each child
+		cost := 2.0 * combinedArea
+		inherit := 2.0 * (combinedArea - area)
+		leftCost := b.descendCost(node.left, box) + inherit
+		rightCost := b.descendCost(node.right, box) + inherit
+
+		if cost < leftCost && cost < rightCost {
+			break
+		}
+		if leftCost < rightCost {
+			sibling = node.left
+		} else {
+			sibling = node.right
+		}
+	}
+
+	oldParent := b.nodes[sibling].parent
+	parent := b.allocNode()
+	b.nodes[parent].parent = oldParent
+	b.nodes[parent].box.Union(&b.nodes[sibling].box, box)
+	b.nodes[parent].left = sibling
+	b.nodes[parent].right = leaf
+	b.nodes[sibling].parent = parent
+	b.nodes[leaf].parent = parent
+
+	if oldParent == bvhNull {
+		b.root = parent
+	} else if b.nodes[oldParent].left == sibling {
+		b.nodes[oldParent].left = parent
+	} else {
+		b.nodes[oldParent].right = parent
+	}
+
+	b.refitFrom(b.nodes[parent].parent)
+}
+
+func (b *BVH) descendCost(n int, box *AABB) float32 {
+	var combined AABB
+	combined.Union(&b.nodes[n].box, box)
+	if b.nodes[n].isLeaf() {
+		return combined.SurfaceArea()
+	}
+	return combined.SurfaceArea() - b.nodes[n].box.SurfaceArea()
+}
+
+// Remove takes an item out of the tree, returning false if it wasn't there
+func (b *BVH) Remove(item int) bool {
+	leaf, ok := b.leaves[item]
+	if !ok {
+		return false
+	}
+	delete(b.leaves, item)
+
+	if leaf == b.root {
+		b.root = bvhNull
+		b.freeNode(leaf)
+		return true
+	}
+
+	parent := b.nodes[leaf].parent
+	grandParent := b.nodes[parent].parent
+	sibling := b.nodes[parent].left
+	if sibling == leaf {
+		sibling = b.nodes[parent].right
+	}
+
+	if grandParent == bvhNull {
+		b.root = sibling
+		b.nodes[sibling].parent = bvhNull
+	} else {
+		if b.nodes[grandParent].left == parent {
+			b.nodes[grandParent].left = sibling
+		} else {
+			b.nodes[grandParent].right = sibling
+		}
+		b.nodes[sibling].parent = grandParent
+		b.refitFrom(grandParent)
+	}
+	b.freeNode(parent)
+	b.freeNode(leaf)
+	return true
+}
+
+// Refit changes an item's bounds in place and grows or shrinks its
+// ancestors to match, without restructuring the tree.  Items that move far
+// are better removed and inserted again.
+func (b *BVH) Refit(item int, box *AABB) bool {
+	leaf, ok := b.leaves[item]
+	if !ok {
+		return false
+	}
+	b.nodes[leaf].box = *box
+	b.refitFrom(b.nodes[leaf].parent)
+	return true
+}
+
+func (b *BVH) refitFrom(n int) {
+	for n != bvhNull {
+		node := &b.nodes[n]
+		node.box.Union(&b.nodes[node.left].box, &b.nodes[node.right].box)
+		n = node.parent
+	}
+}
+
+// Bounds returns the bounds of the whole tree
+func (b *BVH) Bounds(result *AABB) bool {
+	if b.empty() {
+		return false
+	}
+	*result = b.nodes[b.root].box
+	return true
+}
+
+// rayBoxInterval is the slab test returning only the entry and exit
+// parameters, using the precomputed reciprocal of the ray direction
+func rayBoxInterval(ray *Ray, invDir *Vector3, box *AABB, maxDist float32) (float32, bool) {
+	tMin := float32(0.0)
+	tMax := maxDist
+	for i := 0; i < 3; i++ {
+		t1 := (box.Min[i] - ray.Origin[i]) * invDir[i]
+		t2 := (box.Max[i] - ray.Origin[i]) * invDir[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		// NaN from 0 * Inf leaves the bounds as they were
+		if t1 > tMin {
+			tMin = t1
+		}
+		if t2 < tMax {
+			tMax = t2
+		}
+		if tMin > tMax {
+			return 0, false
+		}
+	}
+	return tMin, true
+}
+
+// RayNearest finds the item with the closest hit along the ray within
+// maxDist.  hit is called for each item whose bounds the ray enters and
+// returns the distance of the true hit, and whether there was one.
+func (b *BVH) RayNearest(ray *Ray, maxDist float32, hit func(item int) (float32, bool)) (int, float32, bool) {
+	if b.empty() {
+		return bvhNull, 0, false
+	}
+
+	var invDir Vector3
+	invDir.RecipPerElem(&ray.Direction)
+
+	bestItem := bvhNull
+	bestDist := maxDist
+	stack := make([]int, 0, 64)
+	stack = append(stack, b.root)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &b.nodes[n]
+		if _, ok := rayBoxInterval(ray, &invDir, &node.box, bestDist); !ok {
+			continue
+		}
+		if node.isLeaf() {
+			if dist, ok := hit(node.item); ok && dist <= bestDist {
+				bestDist = dist
+				bestItem = node.item
+			}
+			continue
+		}
+
+		// visit the nearer child first so the far one is more likely to
+		// be culled
+		tLeft, okLeft := rayBoxInterval(ray, &invDir, &b.nodes[node.left].box, bestDist)
+		tRight, okRight := rayBoxInterval(ray, &invDir, &b.nodes[node.right].box, bestDist)
+		switch {
+		case okLeft && okRight:
+			if tLeft < tRight {
+				stack = append(stack, node.right, node.left)
+			} else {
+				stack = append(stack, node.left, node.right)
+			}
+		case okLeft:
+			stack = append(stack, node.left)
+		case okRight:
+			stack = append(stack, node.right)
+		}
+	}
+	return bestItem, bestDist, bestItem != bvhNull
+}
+
+// RayAny returns the first item found whose hit function reports a hit,
+// which is the fastest way to answer line of sight queries
+func (b *BVH) RayAny(ray *Ray, maxDist float32, hit func(item int) bool) (int, bool) {
+	if b.empty() {
+		return bvhNull, false
+	}
+
+	var invDir Vector3
+	invDir.RecipPerElem(&ray.Direction)
+
+	stack := make([]int, 0, 64)
+	stack = append(stack, b.root)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &b.nodes[n]
+		if _, ok := rayBoxInterval(ray, &invDir, &node.box, maxDist); !ok {
+			continue
+		}
+		if node.isLeaf() {
+			if hit(node.item) {
+				return node.item, true
+			}
+			continue
+		}
+		stack = append(stack, node.left, node.right)
+	}
+	return bvhNull, false
+}
+
+// query walks the tree, calling test on each node's bounds.  Subtrees that
+// test Inside are reported without further tests.  fn returns false to
+// stop the query early.
+func (b *BVH) query(test func(box *AABB) Containment, fn func(item int) bool) {
+	if b.empty() {
+		return
+	}
+	stack := make([]int, 0, 64)
+	stack = append(stack, b.root)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch test(&b.nodes[n].box) {
+		case Outside:
+			continue
+		case Inside:
+			if !b.reportAll(n, fn) {
+				return
+			}
+			continue
+		}
+		if b.nodes[n].isLeaf() {
+			if !fn(b.nodes[n].item) {
+				return
+			}
+			continue
+		}
+		stack = append(stack, b.nodes[n].left, b.nodes[n].right)
+	}
+}
+
+func (b *BVH) reportAll(n int, fn func(item int) bool) bool {
+	if b.nodes[n].isLeaf() {
+		return fn(b.nodes[n].item)
+	}
+	return b.reportAll(b.nodes[n].left, fn) && b.reportAll(b.nodes[n].right, fn)
+}
+
+// QueryAABB calls fn for every item whose bounds overlap box, until fn
+// returns false
+func (b *BVH) QueryAABB(box *AABB, fn func(item int) bool) {
+	b.query(func(nodeBox *AABB) Containment {
+		if !box.Overlaps(nodeBox) {
+			return Outside
+		}
+		if box.Contains(nodeBox) {
+			return Inside
+		}
+		return Intersects
+	}, fn)
+}
+
+// QueryFrustum calls fn for every item whose bounds are at least partly
+// inside the frustum, until fn returns false
+func (b *BVH) QueryFrustum(frustum *Frustum, fn func(item int) bool) {
+	b.query(frustum.TestAABB, fn)
+}
+
+// QuerySphere calls fn for every item whose bounds overlap the sphere,
+// until fn returns false
+func (b *BVH) QuerySphere(sphere *Sphere, fn func(item int) bool) {
+	var cp ClosestPoints
+	radiusSqr := sphere.Radius * sphere.Radius
+	b.query(func(nodeBox *AABB) Containment {
+		cp.PointAABB(&sphere.Center, nodeBox)
+		if cp.DistSqr > radiusSqr {
+			return Outside
+		}
+		return Intersects
+	}, fn)
+}
+
+// Pairs calls fn once for every pair of items whose bounds overlap, until
+// fn returns false.  This is the broad phase for collision detection.
+func (b *BVH) Pairs(fn func(itemA, itemB int) bool) {
+	if !b.empty() {
+		b.selfPairs(b.root, fn)
+	}
+}
+
+func (b *BVH) selfPairs(n int, fn func(itemA, itemB int) bool) bool {
+	node := &b.nodes[n]
+	if node.isLeaf() {
+		return true
+	}
+	return b.selfPairs(node.left, fn) &&
+		b.selfPairs(node.right, fn) &&
+		b.crossPairs(node.left, node.right, fn)
+}
+
+func (b *BVH) crossPairs(n0, n1 int, fn func(itemA, itemB int) bool) bool {
+	node0, node1 := &b.nodes[n0], &b.nodes[n1]
+	if !node0.box.Overlaps(&node1.box) {
+		return true
+	}
+	switch {
+	case node0.isLeaf() && node1.isLeaf():
+		return fn(node0.item, node1.item)
+	case node1.isLeaf() || (!node0.isLeaf() && node0.box.SurfaceArea() > node1.box.SurfaceArea()):
+		return b.crossPairs(node0.left, n1, fn) && b.crossPairs(node0.right, n1, fn)
+	default:
+		return b.crossPairs(n0, node1.left, fn) && b.crossPairs(n0, node1.right, fn)
+	}
+}
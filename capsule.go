@@ -0,0 +1,242 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// Segment is the line segment from its first point to its second
+type Segment [2]Point3
+
+// Capsule is the set of points within Radius of a segment.  The segment
+// methods it promotes, such as ClosestParam, work on the axis.
+type Capsule struct {
+	Segment
+	Radius float32
+}
+
+// Segment
+
+func (s *Segment) Direction(result *Vector3) {
+	result.P3Sub(&s[1], &s[0])
+}
+
+func (s *Segment) Length() float32 {
+	return s[0].Dist(&s[1])
+}
+
+func (s *Segment) LengthSqr() float32 {
+	return s[0].DistSqr(&s[1])
+}
+
+// Lerp returns the point a fraction t of the way from the first point to
+// the second
+func (s *Segment) Lerp(result *Point3, t float32) {
+	result.Lerp(t, &s[0], &s[1])
+}
+
+// ClosestParam returns the fraction along the segment of the point closest
+// to pnt
+func (s *Segment) ClosestParam(pnt *Point3) float32 {
+	return closestSegmentParam(pnt, &s[0], &s[1])
+}
+
+func (s *Segment) ClosestPoint(result *Point3, pnt *Point3) {
+	s.Lerp(result, s.ClosestParam(pnt))
+}
+
+func (s *Segment) Support(dir *Vector3) Point3 {
+	if s[1].Projection(dir) > s[0].Projection(dir) {
+		return s[1]
+	}
+	return s[0]
+}
+
+// Capsule
+
+func (c *Capsule) Support(dir *Vector3) Point3 {
+	sphere := Sphere{Center: c.Segment.Support(dir), Radius: c.Radius}
+	return sphere.Support(dir)
+}
+
+func (c *Capsule) ContainsPoint(pnt *Point3) bool {
+	var closest Point3
+	c.Segment.ClosestPoint(&closest, pnt)
+	return closest.DistSqr(pnt) <= c.Radius*c.Radius
+}
+
+// ClosestPoint returns the point on the capsule's surface closest to pnt,
+// or pnt itself if it is inside.  Use Segment.ClosestPoint for the
+// closest point on the axis.
+func (c *Capsule) ClosestPoint(result *Point3, pnt *Point3) {
+	var axis Point3
+	var offset Vector3
+	c.Segment.ClosestPoint(&axis, pnt)
+	offset.P3Sub(pnt, &axis)
+	dist := offset.Length()
+	if dist <= c.Radius {
+		*result = *pnt
+		return
+	}
+	offset.ScalarMulSelf(c.Radius / dist)
+	result.AddV3(&axis, &offset)
+}
+
+// perpendicular returns a unit vector at right angles to vec
+func perpendicular(result, vec *Vector3) {
+	var axis Vector3
+	switch {
+	case abs(vec[x]) <= abs(vec[y]) && abs(vec[x]) <= abs(vec[z]):
+		axis = Vector3{1, 0, 0}
+	case abs(vec[y]) <= abs(vec[z]):
+		axis = Vector3{0, 1, 0}
+	default:
+		axis = Vector3{0, 0, 1}
+	}
+	result.Cross(vec, &axis)
+	result.NormalizeSelf()
+}
+
+// fromClosest inflates the closest points between the cores of two shapes
+// by their radii.  If the cores touch, fallback gives the normal.
+func (result *Contact) fromClosest(cp *ClosestPoints, radiusA, radiusB float32, fallback *Vector3) bool {
+	radius := radiusA + radiusB
+	if cp.DistSqr > radius*radius {
+		return false
+	}
+	dist := sqrt(cp.DistSqr)
+	if dist > g_EPSILON {
+		result.Normal.P3Sub(&cp.PointB, &cp.PointA)
+		result.Normal.ScalarMulSelf(1.0 / dist)
+	} else {
+		result.Normal = *fallback
+	}
+	result.Depth = radius - dist
+
+	var offset Vector3
+	offset.ScalarMul(&result.Normal, radiusA)
+	result.PointA.AddV3(&cp.PointA, &offset)
+	offset.ScalarMul(&result.Normal, radiusB)
+	result.PointB.SubV3(&cp.PointB, &offset)
+	return true
+}
+
+// CapsuleCapsule returns true if the capsules overlap, filling in the
+// contact with the normal pointing from a toward b
+func (result *Contact) CapsuleCapsule(a, b *Capsule) bool {
+	var cp ClosestPoints
+	var fallback, dirA, dirB Vector3
+	cp.SegmentSegment(&a.Segment[0], &a.Segment[1], &b.Segment[0], &b.Segment[1])
+	if cp.DistSqr <= g_EPSILON*g_EPSILON {
+		a.Direction(&dirA)
+		b.Direction(&dirB)
+		fallback.Cross(&dirA, &dirB)
+		if fallback.LengthSqr() > g_EPSILON*g_EPSILON {
+			fallback.NormalizeSelf()
+		} else {
+			perpendicular(&fallback, &dirA)
+		}
+	}
+	return result.fromClosest(&cp, a.Radius, b.Radius, &fallback)
+}
+
+func (result *Contact) CapsuleSphere(a *Capsule, b *Sphere) bool {
+	var cp ClosestPoints
+	var fallback, dir Vector3
+	cp.PointSegment(&b.Center, &a.Segment[0], &a.Segment[1])
+	cp.swap()
+	if cp.DistSqr <= g_EPSILON*g_EPSILON {
+		a.Direction(&dir)
+		perpendicular(&fallback, &dir)
+	}
+	return result.fromClosest(&cp, a.Radius, b.Radius, &fallback)
+}
+
+// nearestFace returns the point of seg closest to the center of box, and
+// the inward normal of the box face nearest that point
+func (box *AABB) nearestFace(normal *Vector3, pnt *Point3, seg *Segment) {
+	var center Point3
+	var half, offset Vector3
+	box.Center(&center)
+	box.HalfExtents(&half)
+	seg.ClosestPoint(pnt, &center)
+	offset.P3Sub(pnt, &center)
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if abs(offset[i])-half[i] > abs(offset[axis])-half[axis] {
+			axis = i
+		}
+	}
+	*normal = Vector3{}
+	normal[axis] = -1.0
+	if offset[axis] < 0.0 {
+		normal[axis] = 1.0
+	}
+}
+
+// CapsuleAABB uses GJK between the capsule's segment and the box, falling
+// back to EPA when the segment itself passes through the box.  A segment
+// just touching the box is pushed out through the nearest face.
+func (result *Contact) CapsuleAABB(a *Capsule, b *AABB) bool {
+	var cp ClosestPoints
+	var fallback Vector3
+	var touch Point3
+	overlap := cp.GJK(&a.Segment, b)
+	if overlap || cp.DistSqr <= g_EPSILON*g_EPSILON {
+		b.nearestFace(&fallback, &touch, &a.Segment)
+	}
+	if !overlap {
+		return result.fromClosest(&cp, a.Radius, 0.0, &fallback)
+	}
+	result.EPA(&a.Segment, b)
+	if result.Normal.LengthSqr() == 0.0 {
+		// only touching, EPA has no normal
+		result.Normal = fallback
+		result.PointA = touch
+		result.PointB = touch
+	}
+	var offset Vector3
+	offset.ScalarMul(&result.Normal, a.Radius)
+	result.PointA.AddV3ToSelf(&offset)
+	result.Depth += a.Radius
+	return true
+}
+
+// CapsuleTriangle returns true if the capsule touches the triangle.  When
+// the segment passes through the triangle the capsule is pushed out along
+// the face normal, to the side holding more of the segment.
+func (result *Contact) CapsuleTriangle(a *Capsule, b *Triangle) bool {
+	var cp ClosestPoints
+	var normal Vector3
+	cp.SegmentTriangle(&a.Segment[0], &a.Segment[1], &b[0], &b[1], &b[2])
+	if cp.DistSqr > g_EPSILON*g_EPSILON {
+		return result.fromClosest(&cp, a.Radius, 0.0, &normal)
+	}
+
+	var plane Plane
+	b.Plane(&plane)
+	plane.Normal(&normal)
+	dist0 := plane.Dist(&a.Segment[0])
+	dist1 := plane.Dist(&a.Segment[1])
+	deep := &a.Segment[0]
+	depth := dist0
+	if abs(dist0) > abs(dist1) {
+		deep = &a.Segment[1]
+		depth = dist1
+	}
+	if dist0+dist1 > 0.0 {
+		// the capsule belongs in front of the face, so b lies behind it
+		normal.NegSelf()
+	}
+	if dist0*dist1 > 0.0 {
+		// the segment only touches the face
+		depth = 0.0
+	}
+
+	result.Normal = normal
+	result.Depth = a.Radius + abs(depth)
+	var offset Vector3
+	offset.ScalarMul(&normal, a.Radius)
+	result.PointA.AddV3(deep, &offset)
+	result.PointB = cp.PointB
+	return true
+}
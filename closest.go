@@ -0,0 +1,240 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// ClosestPoints holds the result of a closest point query between two
+// shapes: PointA lies on the first shape, PointB on the second, and DistSqr
+// is the squared distance between them.  The algorithms follow chapter 5 of
+// Ericson's Real-Time Collision Detection.
+type ClosestPoints struct {
+	PointA, PointB Point3
+	DistSqr        float32
+}
+
+func (result *ClosestPoints) finish() {
+	result.DistSqr = result.PointA.DistSqr(&result.PointB)
+}
+
+func (result *ClosestPoints) swap() {
+	result.PointA, result.PointB = result.PointB, result.PointA
+}
+
+func clamp(val, lo, hi float32) float32 {
+	if val < lo {
+		return lo
+	}
+	if val > hi {
+		return hi
+	}
+	return val
+}
+
+func (result *ClosestPoints) PointSegment(pnt, seg0, seg1 *Point3) {
+	result.PointA = *pnt
+	result.PointB.Lerp(closestSegmentParam(pnt, seg0, seg1), seg0, seg1)
+	result.finish()
+}
+
+// SegmentSegment finds the closest points between segment p0-p1 and
+// segment q0-q1
+func (result *ClosestPoints) SegmentSegment(p0, p1, q0, q1 *Point3) {
+	var d1, d2, r Vector3
+	var s, t float32
+
+	d1.P3Sub(p1, p0)
+	d2.P3Sub(q1, q0)
+	r.P3Sub(p0, q0)
+	a := d1.Dot(&d1)
+	e := d2.Dot(&d2)
+	f := d2.Dot(&r)
+
+	switch {
+	case a <= g_EPSILON && e <= g_EPSILON:
+		// both segments degenerate into points
+		s, t = 0.0, 0.0
+	case a <= g_EPSILON:
+		s = 0.0
+		t = clamp(f/e, 0.0, 1.0)
+	default:
+		c := d1.Dot(&r)
+		if e <= g_EPSILON {
+			t = 0.0
+			s = clamp(-c/a, 0.0, 1.0)
+			break
+		}
+		b := d1.Dot(&d2)
+		denom := a*e - b*b
+		if denom != 0.0 {
+			s = clamp((b*f-c*e)/denom, 0.0, 1.0)
+		} else {
+			// parallel, any s will do
+			s = 0.0
+		}
+		t = (b*s + f) / e
+		if t < 0.0 {
+			t = 0.0
+			s = clamp(-c/a, 0.0, 1.0)
+		} else if t > 1.0 {
+			t = 1.0
+			s = clamp((b-c)/a, 0.0, 1.0)
+		}
+	}
+
+	result.PointA.Lerp(s, p0, p1)
+	result.PointB.Lerp(t, q0, q1)
+	result.finish()
+}
+
+// PointTriangle finds the closest point on triangle tri0, tri1, tri2 by
+// locating the Voronoi region of pnt
+func (result *ClosestPoints) PointTriangle(pnt, tri0, tri1, tri2 *Point3) {
+	var ab, ac, ap, bp, cp, tmpV3 Vector3
+
+	result.PointA = *pnt
+
+	ab.P3Sub(tri1, tri0)
+	ac.P3Sub(tri2, tri0)
+	ap.P3Sub(pnt, tri0)
+	d1 := ab.Dot(&ap)
+	d2 := ac.Dot(&ap)
+	if d1 <= 0.0 && d2 <= 0.0 {
+		result.PointB = *tri0
+		result.finish()
+		return
+	}
+
+	bp.P3Sub(pnt, tri1)
+	d3 := ab.Dot(&bp)
+	d4 := ac.Dot(&bp)
+	if d3 >= 0.0 && d4 <= d3 {
+		result.PointB = *tri1
+		result.finish()
+		return
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0.0 && d1 >= 0.0 && d3 <= 0.0 {
+		result.PointB.Lerp(d1/(d1-d3), tri0, tri1)
+		result.finish()
+		return
+	}
+
+	cp.P3Sub(pnt, tri2)
+	d5 := ab.Dot(&cp)
+	d6 := ac.Dot(&cp)
+	if d6 >= 0.0 && d5 <= d6 {
+		result.PointB = *tri2
+		result.finish()
+		return
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0.0 && d2 >= 0.0 && d6 <= 0.0 {
+		result.PointB.Lerp(d2/(d2-d6), tri0, tri2)
+		result.finish()
+		return
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0.0 && (d4-d3) >= 0.0 && (d5-d6) >= 0.0 {
+		result.PointB.Lerp((d4-d3)/((d4-d3)+(d5-d6)), tri1, tri2)
+		result.finish()
+		return
+	}
+
+	// inside the face region
+	denom := 1.0 / (va + vb + vc)
+	v := vb * denom
+	u := vc * denom
+	ab.ScalarMulSelf(v)
+	ac.ScalarMulSelf(u)
+	tmpV3.Add(&ab, &ac)
+	result.PointB.AddV3(tri0, &tmpV3)
+	result.finish()
+}
+
+func (result *ClosestPoints) PointAABB(pnt *Point3, box *AABB) {
+	result.PointA = *pnt
+	result.PointB.MaxPerElem(pnt, &box.Min)
+	result.PointB.MinPerElemSelf(&box.Max)
+	result.finish()
+}
+
+func (result *ClosestPoints) PointOBB(pnt *Point3, box *OBB) {
+	var local, axis Vector3
+
+	result.PointA = *pnt
+	result.PointB = box.Center
+	box.ToLocal(&local, pnt)
+	for i := 0; i < 3; i++ {
+		box.Axes.Col(&axis, i)
+		axis.ScalarMulSelf(clamp(local[i], -box.HalfExtents[i], box.HalfExtents[i]))
+		result.PointB.AddV3ToSelf(&axis)
+	}
+	result.finish()
+}
+
+// SegmentTriangle finds the closest points between segment seg0-seg1 and
+// triangle tri0, tri1, tri2.  If the segment passes through the triangle
+// both points are the intersection point.
+func (result *ClosestPoints) SegmentTriangle(seg0, seg1, tri0, tri1, tri2 *Point3) {
+	var plane Plane
+	var tmp ClosestPoints
+
+	plane.MakeFromPoints(tri0, tri1, tri2)
+	dist0 := plane.Dist(seg0)
+	dist1 := plane.Dist(seg1)
+	if (dist0 <= 0.0 && dist1 >= 0.0) || (dist0 >= 0.0 && dist1 <= 0.0) {
+		if dist0 != dist1 {
+			var crossing Point3
+			crossing.Lerp(dist0/(dist0-dist1), seg0, seg1)
+			tmp.PointTriangle(&crossing, tri0, tri1, tri2)
+			if tmp.DistSqr <= g_EPSILON {
+				result.PointA = crossing
+				result.PointB = crossing
+				result.DistSqr = 0.0
+				return
+			}
+		}
+	}
+
+	result.PointTriangle(seg0, tri0, tri1, tri2)
+	tmp.PointTriangle(seg1, tri0, tri1, tri2)
+	if tmp.DistSqr < result.DistSqr {
+		*result = tmp
+	}
+
+	edges := [3][2]*Point3{{tri0, tri1}, {tri1, tri2}, {tri2, tri0}}
+	for i := range edges {
+		tmp.SegmentSegment(seg0, seg1, edges[i][0], edges[i][1])
+		if tmp.DistSqr < result.DistSqr {
+			*result = tmp
+		}
+	}
+}
+
+// TriangleTriangle finds the closest points between triangle a0, a1, a2 and
+// triangle b0, b1, b2
+func (result *ClosestPoints) TriangleTriangle(a0, a1, a2, b0, b1, b2 *Point3) {
+	var tmp ClosestPoints
+
+	result.DistSqr = -1.0
+	edgesA := [3][2]*Point3{{a0, a1}, {a1, a2}, {a2, a0}}
+	for i := range edgesA {
+		tmp.SegmentTriangle(edgesA[i][0], edgesA[i][1], b0, b1, b2)
+		if result.DistSqr < 0.0 || tmp.DistSqr < result.DistSqr {
+			*result = tmp
+		}
+	}
+
+	edgesB := [3][2]*Point3{{b0, b1}, {b1, b2}, {b2, b0}}
+	for i := range edgesB {
+		tmp.SegmentTriangle(edgesB[i][0], edgesB[i][1], a0, a1, a2)
+		if tmp.DistSqr < result.DistSqr {
+			tmp.swap()
+			*result = tmp
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// Catmull-Rom knot spacing exponents: uniform spacing can overshoot and
+// form cusps, centripetal spacing never does, and chordal spacing hugs
+// the control polygon most tightly
+const (
+	CatmullRomUniform     = 0.0
+	CatmullRomCentripetal = 0.5
+	CatmullRomChordal     = 1.0
+)
+
+const (
+	curveClosestSamples = 16
+	curveMaxSubdivision = 16
+)
+
+// CubicBezier is a cubic Bézier curve segment.  It passes through its
+// first and last points, and the middle two pull it towards them.  Hermite
+// and Catmull-Rom segments convert exactly to this form.
+type CubicBezier [4]Point3
+
+func bernstein(t float32) (float32, float32, float32, float32) {
+	s := 1.0 - t
+	return s * s * s, 3.0 * t * s * s, 3.0 * t * t * s, t * t * t
+}
+
+func (result *Point3) Bezier(t float32, pnt0, pnt1, pnt2, pnt3 *Point3) {
+	b0, b1, b2, b3 := bernstein(t)
+	for i := 0; i < 3; i++ {
+		result[i] = b0*pnt0[i] + b1*pnt1[i] + b2*pnt2[i] + b3*pnt3[i]
+	}
+}
+
+func (result *Vector3) Bezier(t float32, vec0, vec1, vec2, vec3 *Vector3) {
+	(*Point3)(result).Bezier(t, (*Point3)(vec0), (*Point3)(vec1), (*Point3)(vec2), (*Point3)(vec3))
+}
+
+// Hermite interpolates from pnt0 to pnt1 leaving with tangent tan0 and
+// arriving with tangent tan1
+func (result *Point3) Hermite(t float32, pnt0 *Point3, tan0 *Vector3, pnt1 *Point3, tan1 *Vector3) {
+	var curve CubicBezier
+	curve.MakeFromHermite(pnt0, tan0, pnt1, tan1)
+	curve.Point(result, t)
+}
+
+func (result *Vector3) Hermite(t float32, vec0, tan0, vec1, tan1 *Vector3) {
+	(*Point3)(result).Hermite(t, (*Point3)(vec0), tan0, (*Point3)(vec1), tan1)
+}
+
+// CatmullRom interpolates between pnt1 and pnt2, with pnt0 and pnt3
+// shaping the tangents.  alpha chooses the knot spacing, usually one of
+// CatmullRomUniform, CatmullRomCentripetal or CatmullRomChordal.
+func (result *Point3) CatmullRom(t, alpha float32, pnt0, pnt1, pnt2, pnt3 *Point3) {
+	var curve CubicBezier
+	curve.MakeFromCatmullRom(pnt0, pnt1, pnt2, pnt3, alpha)
+	curve.Point(result, t)
+}
+
+func (result *Vector3) CatmullRom(t, alpha float32, vec0, vec1, vec2, vec3 *Vector3) {
+	(*Point3)(result).CatmullRom(t, alpha, (*Point3)(vec0), (*Point3)(vec1), (*Point3)(vec2), (*Point3)(vec3))
+}
+
+// CubicBezier
+
+func (result *CubicBezier) MakeFromHermite(pnt0 *Point3, tan0 *Vector3, pnt1 *Point3, tan1 *Vector3) {
+	var third Vector3
+	result[0] = *pnt0
+	third.ScalarMul(tan0, 1.0/3.0)
+	result[1].AddV3(pnt0, &third)
+	third.ScalarMul(tan1, 1.0/3.0)
+	result[2].SubV3(pnt1, &third)
+	result[3] = *pnt1
+}
+
+// MakeFromCatmullRom builds the segment from pnt1 to pnt2, with tangents
+// from the Barry-Goldman formulation of non-uniform Catmull-Rom splines
+func (result *CubicBezier) MakeFromCatmullRom(pnt0, pnt1, pnt2, pnt3 *Point3, alpha float32) {
+	knot := func(pnt0, pnt1 *Point3) float32 {
+		dt := pow(pnt0.DistSqr(pnt1), 0.5*alpha)
+		if dt < g_EPSILON {
+			return 1.0
+		}
+		return dt
+	}
+	dt0 := knot(pnt0, pnt1)
+	dt1 := knot(pnt1, pnt2)
+	dt2 := knot(pnt2, pnt3)
+
+	var d10, d20, d21, d31, d32, tan1, tan2 Vector3
+	d10.P3Sub(pnt1, pnt0)
+	d20.P3Sub(pnt2, pnt0)
+	d21.P3Sub(pnt2, pnt1)
+	d31.P3Sub(pnt3, pnt1)
+	d32.P3Sub(pnt3, pnt2)
+	for i := 0; i < 3; i++ {
+		tan1[i] = dt1 * (d10[i]/dt0 - d20[i]/(dt0+dt1) + d21[i]/dt1)
+		tan2[i] = dt1 * (d21[i]/dt1 - d31[i]/(dt1+dt2) + d32[i]/dt2)
+	}
+	result.MakeFromHermite(pnt1, &tan1, pnt2, &tan2)
+}
+
+func (c *CubicBezier) Point(result *Point3, t float32) {
+	result.Bezier(t, &c[0], &c[1], &c[2], &c[3])
+}
+
+// Derivative returns the tangent, the rate of change of position with t
+func (c *CubicBezier) Derivative(result *Vector3, t float32) {
+	var d0, d1, d2 Vector3
+	d0.P3Sub(&c[1], &c[0])
+	d1.P3Sub(&c[2], &c[1])
+	d2.P3Sub(&c[3], &c[2])
+	s := 1.0 - t
+	b0, b1, b2 := 3.0*s*s, 6.0*t*s, 3.0*t*t
+	for i := 0; i < 3; i++ {
+		result[i] = b0*d0[i] + b1*d1[i] + b2*d2[i]
+	}
+}
+
+func (c *CubicBezier) SecondDerivative(result *Vector3, t float32) {
+	for i := 0; i < 3; i++ {
+		a := c[2][i] - 2.0*c[1][i] + c[0][i]
+		b := c[3][i] - 2.0*c[2][i] + c[1][i]
+		result[i] = 6.0 * ((1.0-t)*a + t*b)
+	}
+}
+
+// Split divides the curve at t with de Casteljau's algorithm.  Either
+// result may be the curve itself.
+func (c *CubicBezier) Split(left, right *CubicBezier, t float32) {
+	var p01, p12, p23, p012, p123, mid Point3
+	p01.Lerp(t, &c[0], &c[1])
+	p12.Lerp(t, &c[1], &c[2])
+	p23.Lerp(t, &c[2], &c[3])
+	p012.Lerp(t, &p01, &p12)
+	p123.Lerp(t, &p12, &p23)
+	mid.Lerp(t, &p012, &p123)
+	start, end := c[0], c[3]
+	*left = CubicBezier{start, p01, p012, mid}
+	*right = CubicBezier{mid, p123, p23, end}
+}
+
+// five point Gauss-Legendre quadrature on [-1,1]
+var gaussAbscissae = [5]float32{0.0, -0.5384693101, 0.5384693101, -0.9061798459, 0.9061798459}
+var gaussWeights = [5]float32{0.5688888889, 0.4786286705, 0.4786286705, 0.2369268851, 0.2369268851}
+
+// ArcLength returns the length of the curve from its start to t, by
+// Gauss-Legendre quadrature of the speed over four intervals
+func (c *CubicBezier) ArcLength(t float32) float32 {
+	var deriv Vector3
+	const intervals = 4
+	step := t / intervals
+	length := float32(0.0)
+	for i := 0; i < intervals; i++ {
+		mid := (float32(i) + 0.5) * step
+		for j := range gaussAbscissae {
+			c.Derivative(&deriv, mid+0.5*step*gaussAbscissae[j])
+			length += gaussWeights[j] * deriv.Length()
+		}
+	}
+	return 0.5 * step * length
+}
+
+func (c *CubicBezier) Length() float32 {
+	return c.ArcLength(1.0)
+}
+
+// ParamAtLength returns the t at which the arc length from the start
+// reaches length, for moving along the curve at constant speed
+func (c *CubicBezier) ParamAtLength(length float32) float32 {
+	total := c.Length()
+	if length <= 0.0 || total <= 0.0 {
+		return 0.0
+	}
+	if length >= total {
+		return 1.0
+	}
+
+	// Newton's method, falling back to bisection when it leaves the
+	// bracket
+	var deriv Vector3
+	lo, hi := float32(0.0), float32(1.0)
+	t := length / total
+	for iter := 0; iter < 16; iter++ {
+		diff := c.ArcLength(t) - length
+		if abs(diff) < g_EPSILON*total {
+			break
+		}
+		if diff > 0.0 {
+			hi = t
+		} else {
+			lo = t
+		}
+		c.Derivative(&deriv, t)
+		speed := deriv.Length()
+		next := t - diff/max(speed, g_EPSILON)
+		if next <= lo || next >= hi || speed < g_EPSILON {
+			next = 0.5 * (lo + hi)
+		}
+		t = next
+	}
+	return t
+}
+
+// ClosestParam returns the t of the point on the curve closest to pnt.  The
+// curve is sampled to find the nearest span, then refined with Newton's
+// method on the squared distance.
+func (c *CubicBezier) ClosestParam(pnt *Point3) float32 {
+	var onCurve Point3
+	best := float32(0.0)
+	bestDist := c[0].DistSqr(pnt)
+	for i := 1; i <= curveClosestSamples; i++ {
+		t := float32(i) / curveClosestSamples
+		c.Point(&onCurve, t)
+		if d := onCurve.DistSqr(pnt); d < bestDist {
+			best, bestDist = t, d
+		}
+	}
+
+	var diff, deriv, deriv2 Vector3
+	t := best
+	for iter := 0; iter < 8; iter++ {
+		c.Point(&onCurve, t)
+		c.Derivative(&deriv, t)
+		c.SecondDerivative(&deriv2, t)
+		diff.P3Sub(&onCurve, pnt)
+		num := diff.Dot(&deriv)
+		denom := deriv.Dot(&deriv) + diff.Dot(&deriv2)
+		if abs(denom) < g_EPSILON {
+			break
+		}
+		next := clamp(t-num/denom, 0.0, 1.0)
+		if abs(next-t) < g_EPSILON {
+			t = next
+			break
+		}
+		t = next
+	}
+
+	c.Point(&onCurve, t)
+	if onCurve.DistSqr(pnt) > bestDist {
+		return best
+	}
+	return t
+}
+
+func (c *CubicBezier) ClosestPoint(result *Point3, pnt *Point3) {
+	c.Point(result, c.ClosestParam(pnt))
+}
+
+// Flatten appends points along the curve to result, starting with the
+// first control point, so that the polyline through them strays no more
+// than tolerance from the curve
+func (c *CubicBezier) Flatten(result []Point3, tolerance float32) []Point3 {
+	result = append(result, c[0])
+	return c.flatten(result, tolerance*tolerance, 0)
+}
+
+func (c *CubicBezier) flatten(result []Point3, toleranceSqr float32, depth int) []Point3 {
+	// the curve lies within the hull of its control points, so it is flat
+	// enough when the inner points are close to the chord
+	var cp ClosestPoints
+	cp.PointSegment(&c[1], &c[0], &c[3])
+	dist1 := cp.DistSqr
+	cp.PointSegment(&c[2], &c[0], &c[3])
+	if depth >= curveMaxSubdivision || (dist1 <= toleranceSqr && cp.DistSqr <= toleranceSqr) {
+		return append(result, c[3])
+	}
+	var left, right CubicBezier
+	c.Split(&left, &right, 0.5)
+	result = left.flatten(result, toleranceSqr, depth+1)
+	return right.flatten(result, toleranceSqr, depth+1)
+}
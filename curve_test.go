@@ -0,0 +1,395 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCubicBezier(t *testing.T) {
+	curve := CubicBezier{{0, 0, 0}, {1, 2, 0}, {3, 2, 0}, {4, 0, 0}}
+
+	var pnt Point3
+	curve.Point(&pnt, 0.5)
+	if !p3NearlyEqual(&pnt, &Point3{2, 1.5, 0}) {
+		t.Error("bezier point", pnt)
+	}
+	var deriv Vector3
+	curve.Derivative(&deriv, 0)
+	if !v3NearlyEqual(&deriv, &Vector3{3, 6, 0}) {
+		t.Error("bezier derivative", deriv)
+	}
+	curve.SecondDerivative(&deriv, 0)
+	if !v3NearlyEqual(&deriv, &Vector3{6, -12, 0}) {
+		t.Error("bezier second derivative", deriv)
+	}
+
+	// a straight curve with evenly spaced controls moves at constant speed
+	line := CubicBezier{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}}
+	if !nearlyEqual(line.Length(), 3) || !nearlyEqual(line.ArcLength(0.5), 1.5) {
+		t.Error("bezier line length", line.Length(), line.ArcLength(0.5))
+	}
+
+	// a polyline through many points approximates the true length
+	var prev Point3
+	polyLength := float32(0)
+	for i := 0; i <= 1000; i++ {
+		curve.Point(&pnt, float32(i)/1000)
+		if i > 0 {
+			polyLength += pnt.Dist(&prev)
+		}
+		prev = pnt
+	}
+	if abs(curve.Length()-polyLength) > 1e-3 {
+		t.Error("bezier length", curve.Length(), polyLength)
+	}
+	param := curve.ParamAtLength(0.3 * curve.Length())
+	if !nearlyEqual(curve.ArcLength(param), 0.3*curve.Length()) {
+		t.Error("bezier param at length", param, curve.ArcLength(param))
+	}
+
+	query := Point3{2, 3, 1}
+	closest := curve.ClosestParam(&query)
+	if !nearlyEqual(closest, 0.5) {
+		t.Error("bezier closest param", closest)
+	}
+	curve.ClosestPoint(&pnt, &Point3{5, -1, 0})
+	if !p3NearlyEqual(&pnt, &Point3{4, 0, 0}) {
+		t.Error("bezier closest endpoint", pnt)
+	}
+
+	var left, right CubicBezier
+	curve.Split(&left, &right, 0.25)
+	var a, b Point3
+	left.Point(&a, 0.5)
+	curve.Point(&b, 0.125)
+	if !p3NearlyEqual(&a, &b) || !p3NearlyEqual(&right[0], &left[3]) {
+		t.Error("bezier split", a, b)
+	}
+
+	const tolerance = 0.01
+	pnts := curve.Flatten(nil, tolerance)
+	if len(pnts) < 3 || pnts[0] != curve[0] || pnts[len(pnts)-1] != curve[3] {
+		t.Fatal("bezier flatten ends", pnts)
+	}
+	var cp ClosestPoints
+	for i := 0; i <= 100; i++ {
+		curve.Point(&pnt, float32(i)/100)
+		best := float32(math.MaxFloat32)
+		for j := 1; j < len(pnts); j++ {
+			cp.PointSegment(&pnt, &pnts[j-1], &pnts[j])
+			best = min(best, cp.DistSqr)
+		}
+		if best > tolerance*tolerance*1.01 {
+			t.Error("bezier flatten strays", i, sqrt(best))
+		}
+	}
+}
+
+func TestHermiteCatmullRom(t *testing.T) {
+	var pnt Point3
+	pnt.Hermite(0.5, &Point3{0, 0, 0}, &Vector3{3, 6, 0}, &Point3{4, 0, 0}, &Vector3{3, -6, 0})
+	if !p3NearlyEqual(&pnt, &Point3{2, 1.5, 0}) {
+		t.Error("hermite", pnt)
+	}
+	var vec Vector3
+	vec.Hermite(1, &Vector3{0, 0, 0}, &Vector3{1, 0, 0}, &Vector3{0, 5, 0}, &Vector3{1, 0, 0})
+	if !v3NearlyEqual(&vec, &Vector3{0, 5, 0}) {
+		t.Error("vector hermite", vec)
+	}
+
+	pnts := [4]Point3{{0, 0, 0}, {1, 1, 0}, {3, 1, 0}, {4, 0, 0}}
+	for _, alpha := range []float32{CatmullRomUniform, CatmullRomCentripetal, CatmullRomChordal} {
+		var curve CubicBezier
+		curve.MakeFromCatmullRom(&pnts[0], &pnts[1], &pnts[2], &pnts[3], alpha)
+		if curve[0] != pnts[1] || curve[3] != pnts[2] {
+			t.Error("catmull-rom ends", alpha, curve)
+		}
+		// symmetric controls give a symmetric curve
+		pnt.CatmullRom(0.5, alpha, &pnts[0], &pnts[1], &pnts[2], &pnts[3])
+		if !nearlyEqual(pnt[x], 2) || pnt[y] < 1 {
+			t.Error("catmull-rom middle", alpha, pnt)
+		}
+	}
+
+	// uniform tangents are half the difference of the neighbours
+	var curve CubicBezier
+	curve.MakeFromCatmullRom(&pnts[0], &pnts[1], &pnts[2], &pnts[3], CatmullRomUniform)
+	curve.Derivative(&vec, 0)
+	if !v3NearlyEqual(&vec, &Vector3{1.5, 0.5, 0}) {
+		t.Error("uniform catmull-rom tangent", vec)
+	}
+
+	// a centripetal spline through a tight turn doesn't loop past its
+	// control points
+	tight := [4]Point3{{0, 0, 0}, {0, 1, 0}, {10, 1, 0}, {10, 0, 0}}
+	for i := 0; i <= 20; i++ {
+		pnt.CatmullRom(float32(i)/20, CatmullRomCentripetal, &tight[0], &tight[1], &tight[2], &tight[3])
+		if pnt[x] < -g_EPSILON || pnt[x] > 10+g_EPSILON {
+			t.Error("centripetal catmull-rom overshoots", pnt)
+		}
+	}
+}
+
+func quarterCircle() *NURBSCurve {
+	weight := float32(math.Sqrt(0.5))
+	return &NURBSCurve{
+		Degree: 2,
+		Knots:  []float32{0, 0, 0, 1, 1, 1},
+		ControlPoints: []Vector4{
+			{1, 0, 0, 1},
+			{weight, weight, 0, weight},
+			{0, 1, 0, 1},
+		},
+	}
+}
+
+func TestNURBSCurve(t *testing.T) {
+	circle := quarterCircle()
+	var pnt Point3
+	for i := 0; i <= 10; i++ {
+		circle.Point(&pnt, float32(i)/10)
+		if !nearlyEqual(pnt.DistFromOrigin(), 1) {
+			t.Error("nurbs circle radius", i, pnt)
+		}
+	}
+	circle.Point(&pnt, 1)
+	if !p3NearlyEqual(&pnt, &Point3{0, 1, 0}) {
+		t.Error("nurbs circle end", pnt)
+	}
+	var tangent Vector3
+	circle.Derivative(&tangent, 0.5)
+	circle.Point(&pnt, 0.5)
+	if !nearlyEqual(tangent.Dot(&Vector3{pnt[x], pnt[y], pnt[z]}), 0) {
+		t.Error("nurbs circle tangent", tangent)
+	}
+
+	var spline NURBSCurve
+	spline.MakeBSpline(3, []Point3{{0, 0, 0}, {1, 2, 0}, {2, -1, 1}, {3, 3, 0}, {4, 0, 2}, {5, 1, 0}})
+	lo, hi := spline.Domain()
+	if lo != 0 || hi != 1 {
+		t.Error("bspline domain", lo, hi)
+	}
+
+	// derivatives against central differences
+	const h = 1e-2
+	for _, u := range []float32{0.1, 0.45, 0.8} {
+		var ders, before, after [3]Vector3
+		spline.Derivatives(ders[:], u)
+		spline.Derivatives(before[:], u-h)
+		spline.Derivatives(after[:], u+h)
+		for k := 1; k < 3; k++ {
+			var diff Vector3
+			diff.Sub(&after[k-1], &before[k-1])
+			diff.ScalarMulSelf(1 / (2 * h))
+			for i := 0; i < 3; i++ {
+				if abs(diff[i]-ders[k][i]) > 0.05*max(1, abs(ders[k][i])) {
+					t.Error("bspline derivative", k, u, ders[k], diff)
+					break
+				}
+			}
+		}
+	}
+
+	// knot insertion leaves the shape alone
+	before := make([]Point3, 11)
+	for i := range before {
+		spline.Point(&before[i], float32(i)/10)
+	}
+	spline.InsertKnot(0.3, 2)
+	// no knot repeats more than the degree
+	spline.InsertKnot(0.5, 5)
+	// the ends of the domain already have full multiplicity
+	spline.InsertKnot(0, 2)
+	spline.InsertKnot(1, 2)
+	if len(spline.ControlPoints) != 6+2+3 || len(spline.Knots) != len(spline.ControlPoints)+4 {
+		t.Error("bspline knot insertion counts", len(spline.ControlPoints), len(spline.Knots))
+	}
+	for i := range before {
+		spline.Point(&pnt, float32(i)/10)
+		if !p3NearlyEqual(&pnt, &before[i]) {
+			t.Error("bspline knot insertion moved", i, pnt, before[i])
+		}
+	}
+
+	// nothing asked for, nothing done
+	spline.Derivatives(nil, 0.4)
+	var surface NURBSSurface
+	surface.Derivatives(nil, nil, nil, 0.4, 0.4)
+
+	var ders [4]Vector3
+	if allocs := testing.AllocsPerRun(10, func() { spline.Derivatives(ders[:], 0.4) }); allocs != 0 {
+		t.Error("nurbs derivatives allocated", allocs)
+	}
+
+	circle.InsertKnot(0.5, 1)
+	circle.Point(&pnt, 0.25)
+	if !nearlyEqual(pnt.DistFromOrigin(), 1) {
+		t.Error("nurbs circle knot insertion", pnt)
+	}
+}
+
+func TestNURBSSurface(t *testing.T) {
+	// a quarter cylinder of radius 1 and height 2, swept along v
+	circle := quarterCircle()
+	surface := NURBSSurface{
+		DegreeU: 2, DegreeV: 1,
+		KnotsU: circle.Knots,
+		KnotsV: []float32{0, 0, 1, 1},
+		CountU: 3, CountV: 2,
+	}
+	for _, ctrl := range circle.ControlPoints {
+		top := ctrl
+		top[z] = 2 * ctrl[w]
+		surface.ControlPoints = append(surface.ControlPoints, ctrl, top)
+	}
+
+	var pnt Point3
+	var normal Vector3
+	for _, uv := range [][2]float32{{0, 0}, {0.3, 0.5}, {0.7, 1}, {1, 0.2}} {
+		surface.Point(&pnt, uv[0], uv[1])
+		if !nearlyEqual(pnt[x]*pnt[x]+pnt[y]*pnt[y], 1) || !nearlyEqual(pnt[z], 2*uv[1]) {
+			t.Error("nurbs surface point", uv, pnt)
+		}
+		surface.Normal(&normal, uv[0], uv[1])
+		if !v3NearlyEqual(&normal, &Vector3{pnt[x], pnt[y], 0}) && !v3NearlyEqual(&normal, &Vector3{-pnt[x], -pnt[y], 0}) {
+			t.Error("nurbs surface normal", uv, normal)
+		}
+	}
+
+	surface.Point(&pnt, 0.4, 0.6)
+	surface.InsertKnotU(0.5, 1)
+	surface.InsertKnotV(0.25, 1)
+	if surface.CountU != 4 || surface.CountV != 3 || len(surface.ControlPoints) != 12 {
+		t.Error("nurbs surface knot insertion counts", surface.CountU, surface.CountV)
+	}
+	var after Point3
+	surface.Point(&after, 0.4, 0.6)
+	if !p3NearlyEqual(&pnt, &after) {
+		t.Error("nurbs surface knot insertion moved", pnt, after)
+	}
+
+	positions, normals, indices := surface.Tessellate(4, 3, nil, nil, nil)
+	if len(positions) != 20 || len(normals) != 20 || len(indices) != 4*3*6 {
+		t.Fatal("nurbs tessellation counts", len(positions), len(normals), len(indices))
+	}
+	for i := 0; i < len(indices); i += 3 {
+		tri := Triangle{positions[indices[i]], positions[indices[i+1]], positions[indices[i+2]]}
+		var faceNormal Vector3
+		tri.Normal(&faceNormal)
+		if faceNormal.Dot(&normals[indices[i]]) <= 0 {
+			t.Error("nurbs tessellation winding", i)
+		}
+	}
+	// too few segments still give one cell over the whole domain
+	var corner Point3
+	surface.Point(&corner, 1, 1)
+	positions, _, indices = surface.Tessellate(0, -1, nil, nil, nil)
+	if len(positions) != 4 || len(indices) != 6 || !p3NearlyEqual(&positions[3], &corner) {
+		t.Error("nurbs tessellation with no segments", positions, indices)
+	}
+
+	// a flat bilinear patch
+	var patch NURBSSurface
+	patch.MakeBSpline(1, 1, 2, 2, []Point3{{0, 0, 0}, {0, 1, 0}, {1, 0, 0}, {1, 1, 0}})
+	patch.Normal(&normal, 0.5, 0.5)
+	if !v3NearlyEqual(&normal, &Vector3{0, 0, 1}) {
+		t.Error("bilinear patch normal", normal)
+	}
+}
+
+func checkFrames(t *testing.T, name string, frames Frames) {
+	for i := range frames {
+		f := &frames[i]
+		var cross Vector3
+		cross.Cross(&f.Tangent, &f.Normal)
+		if !nearlyEqual(f.Tangent.Length(), 1) || !nearlyEqual(f.Normal.Length(), 1) ||
+			!nearlyEqual(f.Tangent.Dot(&f.Normal), 0) || !v3NearlyEqual(&cross, &f.Binormal) {
+			t.Error(name, "frame not orthonormal", i, *f)
+			return
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	helix := make([]Point3, 100)
+	for i := range helix {
+		a := float32(i) * 0.1
+		helix[i] = Point3{cos(a), sin(a), 0.2 * a}
+	}
+
+	var frames Frames
+	frames.MakeFrenet(helix, false)
+	checkFrames(t, "frenet", frames)
+	for i := 2; i < len(frames)-2; i++ {
+		expected := Vector3{-helix[i][x], -helix[i][y], 0}
+		if !v3NearlyEqual(&frames[i].Normal, &expected) {
+			t.Error("frenet normal should point to the axis", i, frames[i].Normal)
+			break
+		}
+	}
+
+	var rot Matrix3
+	var q Quaternion
+	var axis Vector3
+	frames[10].ToM3(&rot)
+	frames[10].ToQ(&q)
+	axis.Rotate(&q, &Vector3{1, 0, 0})
+	if !v3NearlyEqual(&axis, &frames[10].Tangent) {
+		t.Error("frame quaternion tangent", axis, frames[10].Tangent)
+	}
+	axis.Rotate(&q, &Vector3{0, 1, 0})
+	if !v3NearlyEqual(&axis, &frames[10].Normal) {
+		t.Error("frame quaternion normal", axis, frames[10].Normal)
+	}
+
+	// a straight line keeps the up vector all the way along
+	line := []Point3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}}
+	frames.MakeRotationMinimizing(line, &Vector3{0, 1, 1}, false)
+	checkFrames(t, "rmf line", frames)
+	up := Vector3{0, float32(math.Sqrt(0.5)), float32(math.Sqrt(0.5))}
+	for i := range frames {
+		if !v3NearlyEqual(&frames[i].Normal, &up) {
+			t.Error("rmf line twisted", i, frames[i].Normal)
+		}
+	}
+
+	// the twist of a rotation minimizing frame about the tangent between
+	// samples is tiny compared with Frenet
+	frames.MakeRotationMinimizing(helix, nil, false)
+	checkFrames(t, "rmf helix", frames)
+	for i := 1; i < len(frames); i++ {
+		var carried Vector3
+		carried = frames[i-1].Binormal
+		twist := carried.Dot(&frames[i].Normal)
+		if abs(twist) > 1e-2 {
+			t.Error("rmf helix twist", i, twist)
+			break
+		}
+	}
+
+	// a closed loop that isn't planar picks up twist, which must be spread
+	// out rather than left as a seam
+	loop := make([]Point3, 64)
+	for i := range loop {
+		a := float32(i) * 2 * math.Pi / float32(len(loop))
+		loop[i] = Point3{cos(a), sin(a), 0.5 * sin(2*a)}
+	}
+	frames.MakeRotationMinimizing(loop, nil, true)
+	checkFrames(t, "rmf loop", frames)
+	maxStep := float32(0)
+	for i := range frames {
+		next := &frames[(i+1)%len(frames)]
+		returned := frames[i].Normal
+		reflectFrame(&returned, &frames[i], next)
+		var cross Vector3
+		cross.Cross(&returned, &next.Normal)
+		maxStep = max(maxStep, abs(atan2(cross.Dot(&next.Tangent), returned.Dot(&next.Normal))))
+	}
+	if maxStep > 0.05 {
+		t.Error("rmf loop seam", maxStep)
+	}
+}
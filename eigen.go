@@ -0,0 +1,116 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+const jacobiMaxSweeps = 32
+
+// SymmetricEigen decomposes the symmetric matrix m into
+// vectors * diag(values) * transpose(vectors) with cyclic Jacobi rotations.
+// Only the lower triangle of m is read.  The eigenvalues are sorted by
+// decreasing magnitude, and the matching unit eigenvectors are the columns
+// of vectors, which always form a right handed rotation.
+func (m *Matrix3) SymmetricEigen(values *Vector3, vectors *Matrix3) {
+	var a, v Matrix3
+	for col := 0; col < 3; col++ {
+		for row := col; row < 3; row++ {
+			a[col*3+row] = m.Elem(col, row)
+			a[row*3+col] = a[col*3+row]
+		}
+	}
+	jacobiEigen(a[:], v[:], 3)
+
+	// sort by magnitude, carrying the eigenvector columns along
+	order := [3]int{0, 1, 2}
+	for i := 1; i < 3; i++ {
+		for j := i; j > 0 && abs(a[order[j]*4]) > abs(a[order[j-1]*4]); j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+	var col0, col1, col2 Vector3
+	v.Col(&col0, order[0])
+	v.Col(&col1, order[1])
+	col2.Cross(&col0, &col1)
+	vectors.MakeFromCols(&col0, &col1, &col2)
+	for i := 0; i < 3; i++ {
+		values[i] = a[order[i]*4]
+	}
+}
+
+// jacobiEigen diagonalizes the symmetric n by n column major matrix a in
+// place with cyclic Jacobi rotations, leaving the eigenvalues on its
+// diagonal and the matching eigenvectors in the columns of v
+func jacobiEigen(a, v []float32, n int) {
+	for i := range v {
+		v[i] = 0.0
+	}
+	for i := 0; i < n; i++ {
+		v[i*n+i] = 1.0
+	}
+
+	for sweep := 0; sweep < jacobiMaxSweeps; sweep++ {
+		off, diag := float32(0.0), float32(0.0)
+		for col := 0; col < n; col++ {
+			diag += a[col*n+col] * a[col*n+col]
+			for row := col + 1; row < n; row++ {
+				off += a[col*n+row] * a[col*n+row]
+			}
+		}
+		if off <= g_EPSILON*g_EPSILON*diag || off == 0.0 {
+			return
+		}
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				jacobiRotate(a, v, n, p, q)
+			}
+		}
+	}
+}
+
+// jacobiRotate zeroes element (p, q) of a by a plane rotation, applied to
+// both sides of a and accumulated into the columns of v
+func jacobiRotate(a, v []float32, n, p, q int) {
+	pp, qq, pq, qp := p*n+p, q*n+q, q*n+p, p*n+q
+	apq := a[pq]
+	if abs(apq) <= g_EPSILON*g_EPSILON*(abs(a[pp])+abs(a[qq])) {
+		a[pq], a[qp] = 0.0, 0.0
+		return
+	}
+	theta := (a[qq] - a[pp]) / (2.0 * apq)
+	t := 1.0 / (abs(theta) + sqrt(theta*theta+1.0))
+	if theta < 0.0 {
+		t = -t
+	}
+	c := 1.0 / sqrt(t*t+1.0)
+	s := t * c
+
+	// columns p and q, then rows p and q
+	for k := 0; k < n; k++ {
+		akp, akq := a[p*n+k], a[q*n+k]
+		a[p*n+k] = c*akp - s*akq
+		a[q*n+k] = s*akp + c*akq
+	}
+	for k := 0; k < n; k++ {
+		apk, aqk := a[k*n+p], a[k*n+q]
+		a[k*n+p] = c*apk - s*aqk
+		a[k*n+q] = s*apk + c*aqk
+	}
+	a[pq], a[qp] = 0.0, 0.0
+
+	for k := 0; k < n; k++ {
+		vkp, vkq := v[p*n+k], v[q*n+k]
+		v[p*n+k] = c*vkp - s*vkq
+		v[q*n+k] = s*vkp + c*vkq
+	}
+}
+
+// Diagonalize finds the rotation that turns the symmetric matrix m into a
+// diagonal one, such that m = rot * diag(values) * conj(rot).  For an
+// inertia tensor this is the orientation of the principal axes.
+func (m *Matrix3) Diagonalize(values *Vector3, rot *Quaternion) {
+	var vectors Matrix3
+	m.SymmetricEigen(values, &vectors)
+	rot.MakeFromM3(&vectors)
+	rot.NormalizeSelf()
+}
@@ -45,3 +45,15 @@ func acos(a float32) float32 {
 func atan(a float32) float32 {
 	return float32(math.Atan(float64(a)))
 }
+
+func floor(a float32) float32 {
+	return float32(math.Floor(float64(a)))
+}
+
+func pow(a, b float32) float32 {
+	return float32(math.Pow(float64(a), float64(b)))
+}
+
+func atan2(a, b float32) float32 {
+	return float32(math.Atan2(float64(a), float64(b)))
+}
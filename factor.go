@@ -0,0 +1,448 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// The factorisations here work on square column major matrices held in
+// slices, so the same code serves Matrix3 and Matrix4 without allocating.
+// Element (col, row) of an n by n matrix a is a[col*n+row].
+
+// LU3 is the LU factorisation of a Matrix3 with partial pivoting
+type LU3 struct {
+	lu   Matrix3
+	perm [3]int
+	sign float32
+	rank int
+}
+
+// LU4 is the LU factorisation of a Matrix4 with partial pivoting
+type LU4 struct {
+	lu   Matrix4
+	perm [4]int
+	sign float32
+	rank int
+}
+
+// QR3 is the Householder QR factorisation of a Matrix3 with column
+// pivoting, m * P = Q * R
+type QR3 struct {
+	qr   Matrix3
+	tau  Vector3
+	piv  [3]int
+	rank int
+}
+
+// QR4 is the Householder QR factorisation of a Matrix4 with column
+// pivoting, m * P = Q * R
+type QR4 struct {
+	qr   Matrix4
+	tau  Vector4
+	piv  [4]int
+	rank int
+}
+
+// Cholesky3 is the factorisation L * transpose(L) of a symmetric positive
+// definite Matrix3
+type Cholesky3 struct {
+	l Matrix3
+}
+
+// Cholesky4 is the factorisation L * transpose(L) of a symmetric positive
+// definite Matrix4
+type Cholesky4 struct {
+	l Matrix4
+}
+
+// factorTolerance is the size below which a pivot counts as zero
+func factorTolerance(a []float32, n int) float32 {
+	scale := float32(0.0)
+	for _, v := range a {
+		scale = max(scale, abs(v))
+	}
+	return g_EPSILON * float32(n) * scale
+}
+
+// luFactor reduces a in place to row echelon form by Gaussian elimination
+// with partial pivoting, leaving the multipliers below the pivots and
+// recording the row order in perm.  It returns the rank, which is the
+// number of pivots, and the sign of the row permutation.  When the rank is
+// n, a holds the unit lower and upper triangles of the usual LU
+// factorisation.
+func luFactor(a []float32, n int, perm []int) (int, float32) {
+	tolerance := factorTolerance(a, n)
+	sign := float32(1.0)
+	for i := range perm {
+		perm[i] = i
+	}
+
+	rank := 0
+	for col := 0; col < n && rank < n; col++ {
+		pivot := rank
+		for row := rank + 1; row < n; row++ {
+			if abs(a[col*n+row]) > abs(a[col*n+pivot]) {
+				pivot = row
+			}
+		}
+		if abs(a[col*n+pivot]) <= tolerance {
+			continue
+		}
+		if pivot != rank {
+			for j := 0; j < n; j++ {
+				a[j*n+pivot], a[j*n+rank] = a[j*n+rank], a[j*n+pivot]
+			}
+			perm[pivot], perm[rank] = perm[rank], perm[pivot]
+			sign = -sign
+		}
+
+		inv := 1.0 / a[col*n+rank]
+		for row := rank + 1; row < n; row++ {
+			f := a[col*n+row] * inv
+			a[col*n+row] = f
+			for j := col + 1; j < n; j++ {
+				a[j*n+row] -= f * a[j*n+rank]
+			}
+		}
+		rank++
+	}
+	return rank, sign
+}
+
+// luSolve solves in place for x, which must already hold the right hand
+// side in the row order of a full rank factorisation
+func luSolve(a []float32, n int, x []float32) {
+	for row := 1; row < n; row++ {
+		for col := 0; col < row; col++ {
+			x[row] -= a[col*n+row] * x[col]
+		}
+	}
+	for row := n - 1; row >= 0; row-- {
+		for col := row + 1; col < n; col++ {
+			x[row] -= a[col*n+row] * x[col]
+		}
+		x[row] /= a[row*n+row]
+	}
+}
+
+// qrFactor replaces a with Householder reflections below the diagonal and
+// R on and above it, choosing at each step the remaining column of
+// largest norm.  Factorisation stops once the remaining columns are
+// negligible, and the number of reflections taken is returned as the rank.
+func qrFactor(a []float32, n int, tau []float32, piv []int) int {
+	tolerance := factorTolerance(a, n)
+	for i := range piv {
+		piv[i] = i
+		tau[i] = 0.0
+	}
+
+	for k := 0; k < n; k++ {
+		best, bestNorm := k, float32(-1.0)
+		for j := k; j < n; j++ {
+			norm := float32(0.0)
+			for i := k; i < n; i++ {
+				norm += a[j*n+i] * a[j*n+i]
+			}
+			if norm > bestNorm {
+				best, bestNorm = j, norm
+			}
+		}
+		norm := sqrt(bestNorm)
+		if norm <= tolerance {
+			return k
+		}
+		if best != k {
+			for i := 0; i < n; i++ {
+				a[best*n+i], a[k*n+i] = a[k*n+i], a[best*n+i]
+			}
+			piv[best], piv[k] = piv[k], piv[best]
+		}
+
+		// reflect the column onto alpha times the kth axis, storing the
+		// reflection vector scaled so its first element is one
+		x0 := a[k*n+k]
+		alpha := norm
+		if x0 > 0.0 {
+			alpha = -norm
+		}
+		v0 := x0 - alpha
+		for i := k + 1; i < n; i++ {
+			a[k*n+i] /= v0
+		}
+		tau[k] = (alpha - x0) / alpha
+		a[k*n+k] = alpha
+
+		for j := k + 1; j < n; j++ {
+			householder(a[j*n:j*n+n], a[k*n:k*n+n], k, tau[k])
+		}
+	}
+	return n
+}
+
+// householder applies the reflection stored in column v below row k to
+// the column vec
+func householder(vec, v []float32, k int, tau float32) {
+	s := vec[k]
+	for i := k + 1; i < len(vec); i++ {
+		s += v[i] * vec[i]
+	}
+	s *= tau
+	vec[k] -= s
+	for i := k + 1; i < len(vec); i++ {
+		vec[i] -= s * v[i]
+	}
+}
+
+// qrSolve finds the least squares solution x of a * x = b, overwriting b.
+// Unknowns in directions the factorisation found negligible are zero.
+func qrSolve(a []float32, n int, tau []float32, piv []int, rank int, b, x []float32) {
+	for k := 0; k < rank; k++ {
+		householder(b, a[k*n:k*n+n], k, tau[k])
+	}
+	for row := rank - 1; row >= 0; row-- {
+		for col := row + 1; col < rank; col++ {
+			b[row] -= a[col*n+row] * b[col]
+		}
+		b[row] /= a[row*n+row]
+	}
+	for i := 0; i < n; i++ {
+		x[piv[i]] = 0.0
+		if i < rank {
+			x[piv[i]] = b[i]
+		}
+	}
+}
+
+// qrQ multiplies the reflections out into the orthogonal matrix q
+func qrQ(a []float32, n int, tau []float32, rank int, q []float32) {
+	for i := range q {
+		q[i] = 0.0
+	}
+	for i := 0; i < n; i++ {
+		q[i*n+i] = 1.0
+	}
+	for k := rank - 1; k >= 0; k-- {
+		for j := 0; j < n; j++ {
+			householder(q[j*n:j*n+n], a[k*n:k*n+n], k, tau[k])
+		}
+	}
+}
+
+// qrR copies out the upper triangle
+func qrR(a []float32, n int, r []float32) {
+	for col := 0; col < n; col++ {
+		for row := 0; row < n; row++ {
+			r[col*n+row] = 0.0
+			if row <= col {
+				r[col*n+row] = a[col*n+row]
+			}
+		}
+	}
+}
+
+// choleskyFactor replaces the lower triangle of a with L, returning false
+// if a is not positive definite.  Only the lower triangle is read, and the
+// upper is cleared.
+func choleskyFactor(a []float32, n int) bool {
+	tolerance := factorTolerance(a, n)
+	for j := 0; j < n; j++ {
+		d := a[j*n+j]
+		for k := 0; k < j; k++ {
+			d -= a[k*n+j] * a[k*n+j]
+		}
+		if d <= tolerance {
+			return false
+		}
+		d = sqrt(d)
+		a[j*n+j] = d
+		for i := j + 1; i < n; i++ {
+			s := a[j*n+i]
+			for k := 0; k < j; k++ {
+				s -= a[k*n+i] * a[k*n+j]
+			}
+			a[j*n+i] = s / d
+			a[i*n+j] = 0.0
+		}
+	}
+	return true
+}
+
+// choleskySolve solves L * transpose(L) * x = b in place
+func choleskySolve(l []float32, n int, x []float32) {
+	for row := 0; row < n; row++ {
+		for col := 0; col < row; col++ {
+			x[row] -= l[col*n+row] * x[col]
+		}
+		x[row] /= l[row*n+row]
+	}
+	for row := n - 1; row >= 0; row-- {
+		for k := row + 1; k < n; k++ {
+			x[row] -= l[row*n+k] * x[k]
+		}
+		x[row] /= l[row*n+row]
+	}
+}
+
+// LU3
+
+func (result *LU3) MakeFromM3(mat *Matrix3) {
+	result.lu = *mat
+	result.rank, result.sign = luFactor(result.lu[:], 3, result.perm[:])
+}
+
+// Rank returns the number of independent rows of the matrix
+func (lu *LU3) Rank() int {
+	return lu.rank
+}
+
+func (lu *LU3) Determinant() float32 {
+	if lu.rank < 3 {
+		return 0.0
+	}
+	return lu.sign * lu.lu[m3col0+x] * lu.lu[m3col1+y] * lu.lu[m3col2+z]
+}
+
+// Solve finds x such that mat * x = b, returning false if the matrix is
+// singular
+func (lu *LU3) Solve(result, b *Vector3) bool {
+	if lu.rank < 3 {
+		return false
+	}
+	var tmp Vector3
+	for i := range tmp {
+		tmp[i] = b[lu.perm[i]]
+	}
+	luSolve(lu.lu[:], 3, tmp[:])
+	*result = tmp
+	return true
+}
+
+// LU4
+
+func (result *LU4) MakeFromM4(mat *Matrix4) {
+	result.lu = *mat
+	result.rank, result.sign = luFactor(result.lu[:], 4, result.perm[:])
+}
+
+func (lu *LU4) Rank() int {
+	return lu.rank
+}
+
+func (lu *LU4) Determinant() float32 {
+	if lu.rank < 4 {
+		return 0.0
+	}
+	return lu.sign * lu.lu[m4col0+x] * lu.lu[m4col1+y] * lu.lu[m4col2+z] * lu.lu[m4col3+w]
+}
+
+func (lu *LU4) Solve(result, b *Vector4) bool {
+	if lu.rank < 4 {
+		return false
+	}
+	var tmp Vector4
+	for i := range tmp {
+		tmp[i] = b[lu.perm[i]]
+	}
+	luSolve(lu.lu[:], 4, tmp[:])
+	*result = tmp
+	return true
+}
+
+// QR3
+
+func (result *QR3) MakeFromM3(mat *Matrix3) {
+	result.qr = *mat
+	result.rank = qrFactor(result.qr[:], 3, result.tau[:], result.piv[:])
+}
+
+// Rank returns the number of independent columns of the matrix.  Column
+// pivoting makes this reliable even for nearly singular matrices.
+func (qr *QR3) Rank() int {
+	return qr.rank
+}
+
+// Pivots returns the column order P, where column i of m * P is column
+// Pivots()[i] of m
+func (qr *QR3) Pivots() [3]int {
+	return qr.piv
+}
+
+func (qr *QR3) Q(result *Matrix3) {
+	qrQ(qr.qr[:], 3, qr.tau[:], qr.rank, result[:])
+}
+
+func (qr *QR3) R(result *Matrix3) {
+	qrR(qr.qr[:], 3, result[:])
+}
+
+// Solve finds the least squares solution x of mat * x = b, returning
+// false if the matrix is rank deficient, in which case x has zeros in the
+// directions that could not be resolved
+func (qr *QR3) Solve(result, b *Vector3) bool {
+	tmp := *b
+	qrSolve(qr.qr[:], 3, qr.tau[:], qr.piv[:], qr.rank, tmp[:], result[:])
+	return qr.rank == 3
+}
+
+// QR4
+
+func (result *QR4) MakeFromM4(mat *Matrix4) {
+	result.qr = *mat
+	result.rank = qrFactor(result.qr[:], 4, result.tau[:], result.piv[:])
+}
+
+func (qr *QR4) Rank() int {
+	return qr.rank
+}
+
+func (qr *QR4) Pivots() [4]int {
+	return qr.piv
+}
+
+func (qr *QR4) Q(result *Matrix4) {
+	qrQ(qr.qr[:], 4, qr.tau[:], qr.rank, result[:])
+}
+
+func (qr *QR4) R(result *Matrix4) {
+	qrR(qr.qr[:], 4, result[:])
+}
+
+func (qr *QR4) Solve(result, b *Vector4) bool {
+	tmp := *b
+	qrSolve(qr.qr[:], 4, qr.tau[:], qr.piv[:], qr.rank, tmp[:], result[:])
+	return qr.rank == 4
+}
+
+// Cholesky3
+
+// MakeFromM3 factors the symmetric matrix mat, reading only its lower
+// triangle, and returns false if it is not positive definite
+func (result *Cholesky3) MakeFromM3(mat *Matrix3) bool {
+	result.l = *mat
+	return choleskyFactor(result.l[:], 3)
+}
+
+// L returns the lower triangular factor
+func (c *Cholesky3) L(result *Matrix3) {
+	*result = c.l
+}
+
+func (c *Cholesky3) Solve(result, b *Vector3) {
+	*result = *b
+	choleskySolve(c.l[:], 3, result[:])
+}
+
+// Cholesky4
+
+func (result *Cholesky4) MakeFromM4(mat *Matrix4) bool {
+	result.l = *mat
+	return choleskyFactor(result.l[:], 4)
+}
+
+func (c *Cholesky4) L(result *Matrix4) {
+	*result = c.l
+}
+
+func (c *Cholesky4) Solve(result, b *Vector4) {
+	*result = *b
+	choleskySolve(c.l[:], 4, result[:])
+}
@@ -0,0 +1,179 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// fitCutoff is the relative singular value below which fitting treats a
+// direction as unconstrained
+const fitCutoff = 1e-5
+
+// centroid returns the mean of pnts
+func centroid(result *Point3, pnts []Point3) {
+	*result = Point3{}
+	for i := range pnts {
+		for j := 0; j < 3; j++ {
+			result[j] += pnts[i][j]
+		}
+	}
+	inv := 1.0 / float32(len(pnts))
+	for j := 0; j < 3; j++ {
+		result[j] *= inv
+	}
+}
+
+// covariance returns the centre of pnts and the sum of the outer products
+// of their offsets from it
+func covariance(center *Point3, cov *Matrix3, pnts []Point3) {
+	centroid(center, pnts)
+	*cov = Matrix3{}
+	var offset Vector3
+	var outer Matrix3
+	for i := range pnts {
+		offset.P3Sub(&pnts[i], center)
+		outer.V3Outer(&offset, &offset)
+		cov.AddToSelf(&outer)
+	}
+}
+
+// MakeFit sets the plane that minimises the sum of squared distances to
+// pnts.  It returns false if there are too few points, or they are
+// collinear, to define a plane.
+func (result *Plane) MakeFit(pnts []Point3) bool {
+	if len(pnts) < 3 {
+		return false
+	}
+	var center Point3
+	var cov, axes Matrix3
+	var spread Vector3
+	covariance(&center, &cov, pnts)
+	cov.SymmetricEigen(&spread, &axes)
+	if spread[y] <= fitCutoff*spread[x] {
+		return false
+	}
+
+	// the normal is the direction of least spread
+	var normal Vector3
+	axes.Col(&normal, 2)
+	result.MakeFromNormalPoint(&normal, &center)
+	return true
+}
+
+// MakeFit sets the line that minimises the sum of squared distances to
+// pnts, as a ray from their centre along the unit direction of greatest
+// spread.  It returns false if the points do not define a direction.
+func (result *Ray) MakeFit(pnts []Point3) bool {
+	if len(pnts) < 2 {
+		return false
+	}
+	var cov, axes Matrix3
+	var spread Vector3
+	covariance(&result.Origin, &cov, pnts)
+	cov.SymmetricEigen(&spread, &axes)
+	if spread[x] <= 0.0 {
+		return false
+	}
+	axes.Col(&result.Direction, 0)
+	return true
+}
+
+// MakeFit sets the sphere that best fits pnts by algebraic least squares.
+// Points on a circle give the sphere centred on the circle.  It returns
+// false if there are fewer than four points or they all coincide.
+func (result *Sphere) MakeFit(pnts []Point3) bool {
+	if len(pnts) < 4 {
+		return false
+	}
+
+	// work relative to the centre and scale of the points to keep the
+	// normal equations well conditioned
+	var center Point3
+	var offset Vector3
+	centroid(&center, pnts)
+	scale := float32(0.0)
+	for i := range pnts {
+		scale += pnts[i].DistSqr(&center)
+	}
+	scale = sqrt(scale / float32(len(pnts)))
+	if scale <= g_EPSILON {
+		return false
+	}
+
+	// |p|^2 = 2 c.p + d for every point p on a sphere with centre c and
+	// d = r^2 - |c|^2, which is linear in c and d
+	var normal, inv Matrix4
+	var rhs, sol, row Vector4
+	for i := range pnts {
+		offset.P3Sub(&pnts[i], &center)
+		offset.ScalarMulSelf(1.0 / scale)
+		row = Vector4{2.0 * offset[x], 2.0 * offset[y], 2.0 * offset[z], 1.0}
+		lengthSqr := offset.LengthSqr()
+		for col := 0; col < 4; col++ {
+			for r := 0; r < 4; r++ {
+				normal[col*4+r] += row[r] * row[col]
+			}
+			rhs[col] += row[col] * lengthSqr
+		}
+	}
+	inv.PseudoInverse(&normal, fitCutoff)
+	sol.MulM4(&rhs, &inv)
+
+	offset = Vector3{sol[x], sol[y], sol[z]}
+	result.Radius = scale * sqrt(max(sol[w]+offset.LengthSqr(), 0.0))
+	offset.ScalarMulSelf(scale)
+	result.Center.AddV3(&center, &offset)
+	return true
+}
+
+// MakeRigidFit sets the rotation and translation that best carries the
+// points in from onto the matching points in to, in the least squares
+// sense, by the Kabsch algorithm.  It returns false if the sets differ in
+// size or are empty.
+func (result *Transform3) MakeRigidFit(from, to []Point3) bool {
+	return result.alignPoints(from, to, false)
+}
+
+// MakeSimilarityFit is MakeRigidFit with a uniform scale as well, by
+// Umeyama's method
+func (result *Transform3) MakeSimilarityFit(from, to []Point3) bool {
+	return result.alignPoints(from, to, true)
+}
+
+func (result *Transform3) alignPoints(from, to []Point3, scaled bool) bool {
+	if len(from) != len(to) || len(from) == 0 {
+		return false
+	}
+
+	var centerFrom, centerTo Point3
+	centroid(&centerFrom, from)
+	centroid(&centerTo, to)
+
+	var cross, outer Matrix3
+	var offsetFrom, offsetTo Vector3
+	variance := float32(0.0)
+	for i := range from {
+		offsetFrom.P3Sub(&from[i], &centerFrom)
+		offsetTo.P3Sub(&to[i], &centerTo)
+		outer.V3Outer(&offsetTo, &offsetFrom)
+		cross.AddToSelf(&outer)
+		variance += offsetFrom.LengthSqr()
+	}
+
+	// the best rotation is the rotation part of the cross covariance, and
+	// with u and v kept proper a reflection shows as a negative last
+	// singular value, which the scale must account for
+	var u, v, vt, rot Matrix3
+	var sigma Vector3
+	cross.SVD(&u, &sigma, &v)
+	vt.Transpose(&v)
+	rot.Mul(&u, &vt)
+	if scaled && variance > 0.0 {
+		rot.ScalarMulSelf(sigma.Sum() / variance)
+	}
+
+	var moved, trans Vector3
+	moved.MulM3((*Vector3)(&centerFrom), &rot)
+	trans.P3Sub(&centerTo, (*Point3)(&moved))
+	result.MakeFromM3V3(&rot, &trans)
+	return true
+}
@@ -0,0 +1,189 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// Frame is an orthonormal frame at a point on a curve, with Tangent along
+// the direction of travel and Normal and Binormal across it.  Tangent,
+// Normal and Binormal form a right handed basis.
+type Frame struct {
+	Position                  Point3
+	Tangent, Normal, Binormal Vector3
+}
+
+// Frames holds one frame per sample of a curve
+type Frames []Frame
+
+// ToM3 returns the rotation taking the x, y and z axes to Tangent, Normal
+// and Binormal
+func (f *Frame) ToM3(result *Matrix3) {
+	result.MakeFromCols(&f.Tangent, &f.Normal, &f.Binormal)
+}
+
+func (f *Frame) ToQ(result *Quaternion) {
+	var rot Matrix3
+	f.ToM3(&rot)
+	result.MakeFromM3(&rot)
+	result.NormalizeSelf()
+}
+
+// setPoints sizes the frames to pnts and fills in positions and unit
+// tangents from central differences, or one sided differences at the ends
+// of open curves
+func (result *Frames) setPoints(pnts []Point3, closed bool) {
+	if cap(*result) < len(pnts) {
+		*result = make(Frames, len(pnts))
+	}
+	*result = (*result)[:len(pnts)]
+	frames := *result
+	n := len(pnts)
+	for i := range frames {
+		frames[i].Position = pnts[i]
+		prev, next := neighbours(i, n, closed)
+		frames[i].Tangent.P3Sub(&pnts[next], &pnts[prev])
+		if frames[i].Tangent.LengthSqr() < g_EPSILON*g_EPSILON {
+			// repeated points keep the previous direction
+			if i > 0 {
+				frames[i].Tangent = frames[i-1].Tangent
+			} else {
+				frames[i].Tangent = Vector3{1, 0, 0}
+			}
+			continue
+		}
+		frames[i].Tangent.NormalizeSelf()
+	}
+}
+
+// neighbours returns the indices either side of sample i, wrapping round
+// closed curves and repeating the end samples of open ones
+func neighbours(i, n int, closed bool) (int, int) {
+	if closed {
+		return (i + n - 1) % n, (i + 1) % n
+	}
+	prev, next := i-1, i+1
+	if prev < 0 {
+		prev = 0
+	}
+	if next > n-1 {
+		next = n - 1
+	}
+	return prev, next
+}
+
+// finish projects the normal to be perpendicular to the tangent and
+// completes the basis with the binormal
+func (f *Frame) finish() {
+	var along Vector3
+	along.ScalarMul(&f.Tangent, f.Normal.Dot(&f.Tangent))
+	f.Normal.SubFromSelf(&along)
+	if f.Normal.LengthSqr() < g_EPSILON*g_EPSILON {
+		perpendicular(&f.Normal, &f.Tangent)
+	}
+	f.Normal.NormalizeSelf()
+	f.Binormal.Cross(&f.Tangent, &f.Normal)
+}
+
+// transportNormal carries the previous frame's normal onto this frame by
+// the shortest rotation between their tangents
+func (f *Frame) transportNormal(prev *Frame) {
+	if prev.Tangent.Dot(&f.Tangent) < -0.99 {
+		// the arc rotation is ill defined for a reversal
+		f.Normal = prev.Normal
+		return
+	}
+	var arc Quaternion
+	arc.MakeRotationArc(&prev.Tangent, &f.Tangent)
+	f.Normal.Rotate(&arc, &prev.Normal)
+}
+
+// MakeFrenet builds Frenet-Serret frames, whose normal points towards the
+// centre of curvature.  On straight stretches, where that is undefined,
+// the previous normal is carried forward.  Frenet frames flip where the
+// curvature changes side, so they suit checking curvature more than
+// sweeping geometry.
+func (result *Frames) MakeFrenet(pnts []Point3, closed bool) {
+	result.setPoints(pnts, closed)
+	frames := *result
+	n := len(frames)
+	for i := range frames {
+		prev, next := neighbours(i, n, closed)
+		frames[i].Normal.Sub(&frames[next].Tangent, &frames[prev].Tangent)
+
+		var along Vector3
+		along.ScalarMul(&frames[i].Tangent, frames[i].Normal.Dot(&frames[i].Tangent))
+		frames[i].Normal.SubFromSelf(&along)
+		if frames[i].Normal.LengthSqr() < g_EPSILON {
+			if i > 0 {
+				frames[i].transportNormal(&frames[i-1])
+			} else {
+				perpendicular(&frames[i].Normal, &frames[i].Tangent)
+			}
+		}
+		frames[i].finish()
+	}
+}
+
+// MakeRotationMinimizing builds frames that twist as little as possible
+// along the curve, using the double reflection method of Wang, Jüttler,
+// Zheng and Liu.  The first normal is up made perpendicular to the first
+// tangent, or any perpendicular if up is nil.  For closed curves the
+// twist left over on returning to the start is spread evenly around the
+// loop so there is no seam.
+func (result *Frames) MakeRotationMinimizing(pnts []Point3, up *Vector3, closed bool) {
+	result.setPoints(pnts, closed)
+	frames := *result
+	if len(frames) == 0 {
+		return
+	}
+
+	if up != nil {
+		frames[0].Normal = *up
+	}
+	frames[0].finish()
+	for i := 1; i < len(frames); i++ {
+		frames[i].Normal = frames[i-1].Normal
+		reflectFrame(&frames[i].Normal, &frames[i-1], &frames[i])
+		frames[i].finish()
+	}
+	if !closed || len(frames) < 2 {
+		return
+	}
+
+	// carry the last frame back round to the first and measure how far
+	// it has turned about the tangent
+	last := &frames[len(frames)-1]
+	returned := last.Normal
+	reflectFrame(&returned, last, &frames[0])
+	var cross Vector3
+	cross.Cross(&returned, &frames[0].Normal)
+	angle := atan2(cross.Dot(&frames[0].Tangent), returned.Dot(&frames[0].Normal))
+
+	n := float32(len(frames))
+	for i := 1; i < len(frames); i++ {
+		var spin Quaternion
+		spin.MakeRotationAxis(angle*float32(i)/n, &frames[i].Tangent)
+		frames[i].Normal.RotateSelf(&spin)
+		frames[i].finish()
+	}
+}
+
+// reflectFrame carries normal from frame a to frame b by reflecting in the
+// plane bisecting their positions, then in the plane bisecting the
+// reflected tangent and b's tangent
+func reflectFrame(normal *Vector3, a, b *Frame) {
+	var v1, v2, tangent, tmp Vector3
+	v1.P3Sub(&b.Position, &a.Position)
+	tangent = a.Tangent
+	if c1 := v1.Dot(&v1); c1 > g_EPSILON*g_EPSILON {
+		tmp.ScalarMul(&v1, 2.0*v1.Dot(normal)/c1)
+		normal.SubFromSelf(&tmp)
+		tmp.ScalarMul(&v1, 2.0*v1.Dot(&tangent)/c1)
+		tangent.SubFromSelf(&tmp)
+	}
+	v2.Sub(&b.Tangent, &tangent)
+	if c2 := v2.Dot(&v2); c2 > g_EPSILON*g_EPSILON {
+		tmp.ScalarMul(&v2, 2.0*v2.Dot(normal)/c2)
+		normal.SubFromSelf(&tmp)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// DepthRange is the clip space depth convention of a projection matrix
+type DepthRange int
+
+const (
+	// DepthNegOneToOne is the OpenGL convention, as produced by
+	// Matrix4.MakePerspective
+	DepthNegOneToOne DepthRange = iota
+	// DepthZeroToOne is the Direct3D / Vulkan / Metal convention
+	DepthZeroToOne
+)
+
+const (
+	FrustumLeft = iota
+	FrustumRight
+	FrustumBottom
+	FrustumTop
+	FrustumNear
+	FrustumFar
+)
+
+// Frustum holds six normalized planes with normals facing inward, indexed
+// by FrustumLeft through FrustumFar
+type Frustum [6]Plane
+
+// MakeFromM4 extracts the planes of a view-projection (or projection)
+// matrix using the Gribb / Hartmann method
+func (result *Frustum) MakeFromM4(viewProj *Matrix4, depth DepthRange) {
+	var row0, row1, row2, row3 Vector4
+
+	viewProj.Row(&row0, 0)
+	viewProj.Row(&row1, 1)
+	viewProj.Row(&row2, 2)
+	viewProj.Row(&row3, 3)
+
+	(*Vector4)(&result[FrustumLeft]).Add(&row3, &row0)
+	(*Vector4)(&result[FrustumRight]).Sub(&row3, &row0)
+	(*Vector4)(&result[FrustumBottom]).Add(&row3, &row1)
+	(*Vector4)(&result[FrustumTop]).Sub(&row3, &row1)
+	if depth == DepthZeroToOne {
+		(*Vector4)(&result[FrustumNear]).Copy(&row2)
+	} else {
+		(*Vector4)(&result[FrustumNear]).Add(&row3, &row2)
+	}
+	(*Vector4)(&result[FrustumFar]).Sub(&row3, &row2)
+
+	for i := range result {
+		result[i].NormalizeSelf()
+	}
+}
+
+func (f *Frustum) TestPoint(pnt *Point3) Containment {
+	for i := range f {
+		if f[i].Dist(pnt) < 0.0 {
+			return Outside
+		}
+	}
+	return Inside
+}
+
+func (f *Frustum) TestSphere(sphere *Sphere) Containment {
+	result := Inside
+	for i := range f {
+		dist := f[i].Dist(&sphere.Center)
+		if dist < -sphere.Radius {
+			return Outside
+		}
+		if dist < sphere.Radius {
+			result = Intersects
+		}
+	}
+	return result
+}
+
+func (f *Frustum) TestAABB(box *AABB) Containment {
+	var pVertex, nVertex Point3
+	result := Inside
+	for i := range f {
+		// pVertex is the corner furthest along the plane normal, nVertex
+		// the corner furthest against it
+		for j := 0; j < 3; j++ {
+			if f[i][j] >= 0.0 {
+				pVertex[j] = box.Max[j]
+				nVertex[j] = box.Min[j]
+			} else {
+				pVertex[j] = box.Min[j]
+				nVertex[j] = box.Max[j]
+			}
+		}
+		if f[i].Dist(&pVertex) < 0.0 {
+			return Outside
+		}
+		if f[i].Dist(&nVertex) < 0.0 {
+			result = Intersects
+		}
+	}
+	return result
+}
+
+// Corners computes the eight corner points of the frustum: the near plane
+// corners followed by the far plane corners, each in the order
+// left-bottom, right-bottom, right-top, left-top.  It returns false if a
+// degenerate frustum leaves any corner undefined.
+func (f *Frustum) Corners(result *[8]Point3) bool {
+	depth := [2]int{FrustumNear, FrustumFar}
+	ok := true
+	for i, d := range depth {
+		ok = intersectPlanes(&result[i*4+0], &f[d], &f[FrustumLeft], &f[FrustumBottom]) && ok
+		ok = intersectPlanes(&result[i*4+1], &f[d], &f[FrustumRight], &f[FrustumBottom]) && ok
+		ok = intersectPlanes(&result[i*4+2], &f[d], &f[FrustumRight], &f[FrustumTop]) && ok
+		ok = intersectPlanes(&result[i*4+3], &f[d], &f[FrustumLeft], &f[FrustumTop]) && ok
+	}
+	return ok
+}
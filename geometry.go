@@ -0,0 +1,263 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+const g_EPSILON = 1e-6
+
+// Containment is the result of testing a volume against a bounding region
+type Containment int
+
+const (
+	Outside Containment = iota
+	Intersects
+	Inside
+)
+
+// Plane is stored as the normal in x, y, z and the distance term in w,
+// so that a point p lies on the plane when n.p + d == 0
+type Plane [4]float32
+
+func (p *Plane) Array() *[4]float32 {
+	return (*[4]float32)(p)
+}
+
+// AABB is an axis aligned bounding box
+type AABB struct {
+	Min, Max Point3
+}
+
+type Sphere struct {
+	Center Point3
+	Radius float32
+}
+
+// OBB is an oriented bounding box.  The columns of Axes are the unit
+// local axes, and HalfExtents the half widths along each of them
+type OBB struct {
+	Center      Point3
+	Axes        Matrix3
+	HalfExtents Vector3
+}
+
+// Plane
+
+func (result *Plane) MakeFromNormalPoint(unitNormal *Vector3, pnt *Point3) {
+	result[x] = unitNormal[x]
+	result[y] = unitNormal[y]
+	result[z] = unitNormal[z]
+	result[w] = -pnt.Projection(unitNormal)
+}
+
+// MakeFromPoints builds the plane through three points, with the normal
+// facing the side from which pnt0, pnt1, pnt2 wind counter-clockwise
+func (result *Plane) MakeFromPoints(pnt0, pnt1, pnt2 *Point3) {
+	var edge0, edge1, normal Vector3
+	edge0.P3Sub(pnt1, pnt0)
+	edge1.P3Sub(pnt2, pnt0)
+	normal.Cross(&edge0, &edge1)
+	normal.NormalizeSelf()
+	result.MakeFromNormalPoint(&normal, pnt0)
+}
+
+func (p *Plane) Copy(other *Plane) {
+	p[x] = other[x]
+	p[y] = other[y]
+	p[z] = other[z]
+	p[w] = other[w]
+}
+
+func (p *Plane) Normal(result *Vector3) {
+	result[x] = p[x]
+	result[y] = p[y]
+	result[z] = p[z]
+}
+
+func (result *Plane) Normalize(plane *Plane) {
+	lenInv := 1.0 / sqrt(plane[x]*plane[x]+plane[y]*plane[y]+plane[z]*plane[z])
+	result[x] = plane[x] * lenInv
+	result[y] = plane[y] * lenInv
+	result[z] = plane[z] * lenInv
+	result[w] = plane[w] * lenInv
+}
+
+func (result *Plane) NormalizeSelf() {
+	result.Normalize(result)
+}
+
+// Dist returns the signed distance from the plane to pnt, positive on the
+// side the normal faces.  The plane must be normalized.
+func (p *Plane) Dist(pnt *Point3) float32 {
+	return p[x]*pnt[x] + p[y]*pnt[y] + p[z]*pnt[z] + p[w]
+}
+
+func (p *Plane) ClosestPoint(result *Point3, pnt *Point3) {
+	var normal Vector3
+	p.Normal(&normal)
+	normal.ScalarMulSelf(p.Dist(pnt))
+	result.SubV3(pnt, &normal)
+}
+
+// intersectPlanes finds the single point shared by three planes
+func intersectPlanes(result *Point3, plane0, plane1, plane2 *Plane) bool {
+	var n0, n1, n2, cross01, cross12, cross20, sum Vector3
+	plane0.Normal(&n0)
+	plane1.Normal(&n1)
+	plane2.Normal(&n2)
+	cross12.Cross(&n1, &n2)
+	denom := n0.Dot(&cross12)
+	if abs(denom) < g_EPSILON {
+		return false
+	}
+	cross20.Cross(&n2, &n0)
+	cross01.Cross(&n0, &n1)
+	cross12.ScalarMulSelf(plane0[w])
+	cross20.ScalarMulSelf(plane1[w])
+	cross01.ScalarMulSelf(plane2[w])
+	sum.Add(&cross12, &cross20)
+	sum.AddToSelf(&cross01)
+	sum.ScalarMulSelf(-1.0 / denom)
+	result.MakeFromV3(&sum)
+	return true
+}
+
+// AABB
+
+func (result *AABB) MakeFromPoints(pnts []Point3) {
+	if len(pnts) == 0 {
+		*result = AABB{}
+		return
+	}
+	result.Min = pnts[0]
+	result.Max = pnts[0]
+	for i := 1; i < len(pnts); i++ {
+		result.Min.MinPerElemSelf(&pnts[i])
+		result.Max.MaxPerElemSelf(&pnts[i])
+	}
+}
+
+func (result *AABB) MakeFromSphere(sphere *Sphere) {
+	var radius Vector3
+	radius.MakeFromScalar(sphere.Radius)
+	result.Min.SubV3(&sphere.Center, &radius)
+	result.Max.AddV3(&sphere.Center, &radius)
+}
+
+func (result *AABB) MakeFromOBB(box *OBB) {
+	var absAxes Matrix3
+	var extent Vector3
+	absAxes.AbsPerElem(&box.Axes)
+	extent.MulM3(&box.HalfExtents, &absAxes)
+	result.Min.SubV3(&box.Center, &extent)
+	result.Max.AddV3(&box.Center, &extent)
+}
+
+func (a *AABB) Center(result *Point3) {
+	result.Lerp(0.5, &a.Min, &a.Max)
+}
+
+func (a *AABB) HalfExtents(result *Vector3) {
+	result.P3Sub(&a.Max, &a.Min)
+	result.ScalarMulSelf(0.5)
+}
+
+func (a *AABB) SurfaceArea() float32 {
+	var size Vector3
+	size.P3Sub(&a.Max, &a.Min)
+	return 2.0 * (size[x]*size[y] + size[y]*size[z] + size[z]*size[x])
+}
+
+func (a *AABB) Volume() float32 {
+	var size Vector3
+	size.P3Sub(&a.Max, &a.Min)
+	return size[x] * size[y] * size[z]
+}
+
+func (result *AABB) Union(box0, box1 *AABB) {
+	result.Min.MinPerElem(&box0.Min, &box1.Min)
+	result.Max.MaxPerElem(&box0.Max, &box1.Max)
+}
+
+func (result *AABB) UnionSelf(box *AABB) {
+	result.Union(result, box)
+}
+
+func (result *AABB) AddPoint(pnt *Point3) {
+	result.Min.MinPerElemSelf(pnt)
+	result.Max.MaxPerElemSelf(pnt)
+}
+
+func (a *AABB) ContainsPoint(pnt *Point3) bool {
+	return pnt[x] >= a.Min[x] && pnt[x] <= a.Max[x] &&
+		pnt[y] >= a.Min[y] && pnt[y] <= a.Max[y] &&
+		pnt[z] >= a.Min[z] && pnt[z] <= a.Max[z]
+}
+
+func (a *AABB) Contains(box *AABB) bool {
+	return a.ContainsPoint(&box.Min) && a.ContainsPoint(&box.Max)
+}
+
+func (a *AABB) Overlaps(box *AABB) bool {
+	return a.Min[x] <= box.Max[x] && a.Max[x] >= box.Min[x] &&
+		a.Min[y] <= box.Max[y] && a.Max[y] >= box.Min[y] &&
+		a.Min[z] <= box.Max[z] && a.Max[z] >= box.Min[z]
+}
+
+// Sphere
+
+func (s *Sphere) ContainsPoint(pnt *Point3) bool {
+	return s.Center.DistSqr(pnt) <= s.Radius*s.Radius
+}
+
+func (s *Sphere) Overlaps(sphere *Sphere) bool {
+	radius := s.Radius + sphere.Radius
+	return s.Center.DistSqr(&sphere.Center) <= radius*radius
+}
+
+// OBB
+
+func (result *OBB) MakeFromAABB(box *AABB) {
+	box.Center(&result.Center)
+	box.HalfExtents(&result.HalfExtents)
+	result.Axes.MakeIdentity()
+}
+
+// ToLocal expresses a world space point in the box's frame, relative to its
+// center
+func (b *OBB) ToLocal(result *Vector3, pnt *Point3) {
+	var d, axis Vector3
+	d.P3Sub(pnt, &b.Center)
+	for i := 0; i < 3; i++ {
+		b.Axes.Col(&axis, i)
+		result[i] = d.Dot(&axis)
+	}
+}
+
+func (b *OBB) ContainsPoint(pnt *Point3) bool {
+	var local Vector3
+	b.ToLocal(&local, pnt)
+	return abs(local[x]) <= b.HalfExtents[x] &&
+		abs(local[y]) <= b.HalfExtents[y] &&
+		abs(local[z]) <= b.HalfExtents[z]
+}
+
+// closestSegmentParam returns the parameter along pnt0->pnt1 of the point
+// on the segment closest to pnt, clamped to [0,1]
+func closestSegmentParam(pnt, pnt0, pnt1 *Point3) float32 {
+	var ab, ap Vector3
+	ab.P3Sub(pnt1, pnt0)
+	ap.P3Sub(pnt, pnt0)
+	lenSqr := ab.LengthSqr()
+	if lenSqr < g_EPSILON {
+		return 0.0
+	}
+	t := ap.Dot(&ab) / lenSqr
+	if t < 0.0 {
+		return 0.0
+	}
+	if t > 1.0 {
+		return 1.0
+	}
+	return t
+}
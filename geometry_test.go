@@ -0,0 +1,678 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+	"testing"
+)
+
+const testTolerance = 1e-4
+
+func nearlyEqual(a, b float32) bool {
+	return abs(a-b) <= testTolerance
+}
+
+func v3NearlyEqual(vec0, vec1 *Vector3) bool {
+	return nearlyEqual(vec0[x], vec1[x]) && nearlyEqual(vec0[y], vec1[y]) && nearlyEqual(vec0[z], vec1[z])
+}
+
+func p3NearlyEqual(pnt0, pnt1 *Point3) bool {
+	return v3NearlyEqual((*Vector3)(pnt0), (*Vector3)(pnt1))
+}
+
+func checkHit(t *testing.T, name string, hit *RayHit, dist float32, pnt *Point3, normal *Vector3) {
+	if !nearlyEqual(hit.Distance, dist) {
+		t.Error(name, "distance", hit.Distance, dist)
+	}
+	if !p3NearlyEqual(&hit.Point, pnt) {
+		t.Error(name, "point", hit.Point, *pnt)
+	}
+	if !v3NearlyEqual(&hit.Normal, normal) {
+		t.Error(name, "normal", hit.Normal, *normal)
+	}
+}
+
+func TestRayIntersect(t *testing.T) {
+	var hit RayHit
+	ray := &Ray{Origin: Point3{0, 0, -10}, Direction: Vector3{0, 0, 1}}
+
+	plane := &Plane{}
+	plane.MakeFromNormalPoint(&Vector3{0, 0, -1}, &Point3{0, 0, 2})
+	if !ray.IntersectPlane(plane, &hit) {
+		t.Fatal("plane missed")
+	}
+	checkHit(t, "plane", &hit, 12, &Point3{0, 0, 2}, &Vector3{0, 0, -1})
+
+	box := &AABB{Min: Point3{-1, -1, -1}, Max: Point3{1, 1, 1}}
+	if !ray.IntersectAABB(box, &hit) {
+		t.Fatal("aabb missed")
+	}
+	checkHit(t, "aabb", &hit, 9, &Point3{0, 0, -1}, &Vector3{0, 0, -1})
+
+	inside := &Ray{Origin: Point3{0, 0, 0}, Direction: Vector3{1, 0, 0}}
+	if !inside.IntersectAABB(box, &hit) {
+		t.Fatal("aabb from inside missed")
+	}
+	checkHit(t, "aabb inside", &hit, 1, &Point3{1, 0, 0}, &Vector3{1, 0, 0})
+
+	sphere := &Sphere{Center: Point3{0, 0, 0}, Radius: 2}
+	if !ray.IntersectSphere(sphere, &hit) {
+		t.Fatal("sphere missed")
+	}
+	checkHit(t, "sphere", &hit, 8, &Point3{0, 0, -2}, &Vector3{0, 0, -1})
+
+	obb := &OBB{HalfExtents: Vector3{1, 1, 1}}
+	obb.Axes.MakeRotationZ(0.5)
+	if !ray.IntersectOBB(obb, &hit) {
+		t.Fatal("obb missed")
+	}
+	checkHit(t, "obb", &hit, 9, &Point3{0, 0, -1}, &Vector3{0, 0, -1})
+
+	if !ray.IntersectTriangle(&Point3{-1, -1, 0}, &Point3{1, -1, 0}, &Point3{-1, 1, 0}, &hit) {
+		t.Fatal("triangle missed")
+	}
+	checkHit(t, "triangle", &hit, 10, &Point3{0, 0, 0}, &Vector3{0, 0, 1})
+	if !nearlyEqual(hit.U, 0.5) || !nearlyEqual(hit.V, 0.5) {
+		t.Error("triangle barycentrics", hit.U, hit.V)
+	}
+	// the parallel test is relative, so tiny triangles and short
+	// directions still hit
+	small := &Ray{Origin: Point3{1e-4, 1e-4, 1}, Direction: Vector3{0, 0, -1}}
+	if !small.IntersectTriangle(&Point3{0, 0, 0}, &Point3{5e-4, 0, 0}, &Point3{0, 5e-4, 0}, &hit) {
+		t.Error("small triangle missed")
+	}
+	slow := &Ray{Origin: Point3{0.25, 0.25, 1}, Direction: Vector3{0, 0, -2.5e-7}}
+	if !slow.IntersectTriangle(&Point3{0, 0, 0}, &Point3{1, 0, 0}, &Point3{0, 1, 0}, &hit) {
+		t.Error("triangle missed by short direction")
+	}
+
+	side := &Ray{Origin: Point3{-10, 0, 0.5}, Direction: Vector3{1, 0, 0}}
+	if !side.IntersectCapsule(&Point3{0, 0, -1}, &Point3{0, 0, 1}, 1, &hit) {
+		t.Fatal("capsule missed")
+	}
+	checkHit(t, "capsule body", &hit, 9, &Point3{-1, 0, 0.5}, &Vector3{-1, 0, 0})
+	if !ray.IntersectCapsule(&Point3{0, 0, -1}, &Point3{0, 0, 1}, 1, &hit) {
+		t.Fatal("capsule missed")
+	}
+	checkHit(t, "capsule cap", &hit, 8, &Point3{0, 0, -2}, &Vector3{0, 0, -1})
+
+	if !ray.IntersectCylinder(&Point3{0, 0, -1}, &Point3{0, 0, 1}, 1, &hit) {
+		t.Fatal("cylinder missed")
+	}
+	checkHit(t, "cylinder cap", &hit, 9, &Point3{0, 0, -1}, &Vector3{0, 0, -1})
+	if !side.IntersectCylinder(&Point3{0, 0, -1}, &Point3{0, 0, 1}, 1, &hit) {
+		t.Fatal("cylinder missed")
+	}
+	checkHit(t, "cylinder body", &hit, 9, &Point3{-1, 0, 0.5}, &Vector3{-1, 0, 0})
+
+	miss := &Ray{Origin: Point3{5, 5, -10}, Direction: Vector3{0, 0, 1}}
+	if miss.IntersectSphere(sphere, &hit) || miss.IntersectAABB(box, &hit) ||
+		miss.IntersectCylinder(&Point3{0, 0, -1}, &Point3{0, 0, 1}, 1, &hit) {
+		t.Error("expected miss")
+	}
+}
+
+func TestFrustum(t *testing.T) {
+	var proj, view, viewProj, remap Matrix4
+	var frustum Frustum
+	var corners [8]Point3
+
+	proj.MakePerspective(g_PI_OVER_2, 1, 1, 10)
+	view.MakeLookAt(&Point3{0, 0, 0}, &Point3{0, 0, -1}, &Vector3{0, 1, 0})
+	viewProj.Mul(&proj, &view)
+
+	// the same projection remapped to a [0,1] depth range
+	remap.MakeIdentity()
+	remap.SetElem(2, 2, 0.5)
+	remap.SetElem(3, 2, 0.5)
+	remap.MulSelf(&viewProj)
+
+	expected := [8]Point3{
+		{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1},
+		{-10, -10, -10}, {10, -10, -10}, {10, 10, -10}, {-10, 10, -10},
+	}
+
+	for _, depth := range []DepthRange{DepthNegOneToOne, DepthZeroToOne} {
+		if depth == DepthZeroToOne {
+			frustum.MakeFromM4(&remap, depth)
+		} else {
+			frustum.MakeFromM4(&viewProj, depth)
+		}
+
+		if !frustum.Corners(&corners) {
+			t.Error("corners failed", depth)
+		}
+		for i := range corners {
+			if !p3NearlyEqual(&corners[i], &expected[i]) {
+				t.Error("corner", depth, i, corners[i], expected[i])
+			}
+		}
+		degenerate := frustum
+		degenerate[FrustumFar] = Plane{}
+		if degenerate.Corners(&corners) {
+			t.Error("degenerate frustum corners should fail", depth)
+		}
+
+		if frustum.TestPoint(&Point3{0, 0, -5}) != Inside {
+			t.Error("point should be inside", depth)
+		}
+		if frustum.TestPoint(&Point3{0, 0, -11}) != Outside {
+			t.Error("point should be outside", depth)
+		}
+		if frustum.TestSphere(&Sphere{Center: Point3{0, 0, -5}, Radius: 1}) != Inside {
+			t.Error("sphere should be inside", depth)
+		}
+		if frustum.TestSphere(&Sphere{Center: Point3{0, 0, -0.5}, Radius: 1}) != Intersects {
+			t.Error("sphere should intersect", depth)
+		}
+		if frustum.TestSphere(&Sphere{Center: Point3{0, 0, 5}, Radius: 1}) != Outside {
+			t.Error("sphere should be outside", depth)
+		}
+		if frustum.TestAABB(&AABB{Min: Point3{-1, -1, -6}, Max: Point3{1, 1, -4}}) != Inside {
+			t.Error("aabb should be inside", depth)
+		}
+		if frustum.TestAABB(&AABB{Min: Point3{-1, -1, -12}, Max: Point3{1, 1, -8}}) != Intersects {
+			t.Error("aabb should intersect", depth)
+		}
+		if frustum.TestAABB(&AABB{Min: Point3{20, -1, -6}, Max: Point3{22, 1, -4}}) != Outside {
+			t.Error("aabb should be outside", depth)
+		}
+	}
+}
+
+func checkClosest(t *testing.T, name string, result *ClosestPoints, pntA, pntB *Point3, distSqr float32) {
+	if !p3NearlyEqual(&result.PointA, pntA) || !p3NearlyEqual(&result.PointB, pntB) {
+		t.Error(name, "points", result.PointA, result.PointB, *pntA, *pntB)
+	}
+	if !nearlyEqual(result.DistSqr, distSqr) {
+		t.Error(name, "distance", result.DistSqr, distSqr)
+	}
+}
+
+func TestClosestPoints(t *testing.T) {
+	var result ClosestPoints
+	tri := [3]Point3{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}}
+
+	result.PointSegment(&Point3{1, 1, 0}, &Point3{0, 0, 0}, &Point3{2, 0, 0})
+	checkClosest(t, "point segment", &result, &Point3{1, 1, 0}, &Point3{1, 0, 0}, 1)
+
+	result.SegmentSegment(&Point3{0, 0, 0}, &Point3{2, 0, 0}, &Point3{1, -1, 1}, &Point3{1, 1, 1})
+	checkClosest(t, "segment segment", &result, &Point3{1, 0, 0}, &Point3{1, 0, 1}, 1)
+
+	result.PointTriangle(&Point3{0.5, 0.5, 3}, &tri[0], &tri[1], &tri[2])
+	checkClosest(t, "point triangle face", &result, &Point3{0.5, 0.5, 3}, &Point3{0.5, 0.5, 0}, 9)
+	result.PointTriangle(&Point3{2, 2, 0}, &tri[0], &tri[1], &tri[2])
+	checkClosest(t, "point triangle edge", &result, &Point3{2, 2, 0}, &Point3{1, 1, 0}, 2)
+	result.PointTriangle(&Point3{-1, -1, 0}, &tri[0], &tri[1], &tri[2])
+	checkClosest(t, "point triangle vertex", &result, &Point3{-1, -1, 0}, &Point3{0, 0, 0}, 2)
+
+	result.PointAABB(&Point3{3, 0.5, -4}, &AABB{Min: Point3{-1, -1, -1}, Max: Point3{1, 1, 1}})
+	checkClosest(t, "point aabb", &result, &Point3{3, 0.5, -4}, &Point3{1, 0.5, -1}, 13)
+
+	obb := &OBB{Center: Point3{1, 1, 1}, HalfExtents: Vector3{1, 1, 1}}
+	obb.Axes.MakeIdentity()
+	result.PointOBB(&Point3{1, 4, 1}, obb)
+	checkClosest(t, "point obb", &result, &Point3{1, 4, 1}, &Point3{1, 2, 1}, 4)
+
+	result.SegmentTriangle(&Point3{0.5, 0.5, -1}, &Point3{0.5, 0.5, 1}, &tri[0], &tri[1], &tri[2])
+	checkClosest(t, "segment triangle crossing", &result, &Point3{0.5, 0.5, 0}, &Point3{0.5, 0.5, 0}, 0)
+	result.SegmentTriangle(&Point3{2, 2, 1}, &Point3{3, 3, 1}, &tri[0], &tri[1], &tri[2])
+	checkClosest(t, "segment triangle apart", &result, &Point3{2, 2, 1}, &Point3{1, 1, 0}, 3)
+
+	result.TriangleTriangle(&tri[0], &tri[1], &tri[2], &Point3{3, 3, -1}, &Point3{3, 3, 1}, &Point3{5, 5, 0})
+	checkClosest(t, "triangle triangle", &result, &Point3{1, 1, 0}, &Point3{3, 3, 0}, 8)
+}
+
+func TestGJK(t *testing.T) {
+	var closest ClosestPoints
+	var contact Contact
+
+	sphereA := &Sphere{Center: Point3{0, 0, 0}, Radius: 1}
+	sphereB := &Sphere{Center: Point3{3, 0, 0}, Radius: 1}
+	if closest.GJK(sphereA, sphereB) {
+		t.Fatal("spheres should be separated")
+	}
+	checkClosest(t, "gjk spheres", &closest, &Point3{1, 0, 0}, &Point3{2, 0, 0}, 1)
+
+	sphereB.Center = Point3{1.5, 0, 0}
+	if !contact.EPA(sphereA, sphereB) {
+		t.Fatal("spheres should overlap")
+	}
+	if abs(contact.Depth-0.5) > 0.01 {
+		t.Error("epa sphere depth", contact.Depth)
+	}
+	if contact.Normal[x] < 0.99 {
+		t.Error("epa sphere normal", contact.Normal)
+	}
+
+	box := &AABB{Min: Point3{-1, -1, -1}, Max: Point3{1, 1, 1}}
+	moved := &TransformedSupport{Shape: box}
+	moved.Transform.MakeTranslation(&Vector3{0, 1.75, 0})
+	if !contact.EPA(box, moved) {
+		t.Fatal("boxes should overlap")
+	}
+	if !nearlyEqual(contact.Depth, 0.25) {
+		t.Error("epa box depth", contact.Depth)
+	}
+	if !v3NearlyEqual(&contact.Normal, &Vector3{0, 1, 0}) {
+		t.Error("epa box normal", contact.Normal)
+	}
+	if !nearlyEqual(contact.PointA[y], 1) || !nearlyEqual(contact.PointB[y], 0.75) {
+		t.Error("epa box points", contact.PointA, contact.PointB)
+	}
+
+	obb := &OBB{Center: Point3{0, 4, 0}, HalfExtents: Vector3{1, 1, 1}}
+	obb.Axes.MakeRotationZ(math.Pi / 4)
+	if closest.GJK(box, obb) {
+		t.Fatal("box and obb should be separated")
+	}
+	if !nearlyEqual(closest.DistSqr, (3-math.Sqrt2)*(3-math.Sqrt2)) {
+		t.Error("gjk box obb distance", closest.DistSqr)
+	}
+}
+
+func checkHull(t *testing.T, name string, hull *ConvexHull, pnts []Point3) {
+	for i := range hull.Faces {
+		f := &hull.Faces[i]
+		for j := 0; j < 3; j++ {
+			n := &hull.Faces[f.Adjacent[j]]
+			found := false
+			for k := 0; k < 3; k++ {
+				if n.Indices[k] == f.Indices[(j+1)%3] && n.Indices[(k+1)%3] == f.Indices[j] && n.Adjacent[k] == i {
+					found = true
+				}
+			}
+			if !found {
+				t.Error(name, "face", i, "edge", j, "adjacency mismatch")
+			}
+		}
+	}
+	for i := range pnts {
+		for j := range hull.Faces {
+			if hull.Faces[j].Plane.Dist(&pnts[i]) > 1e-3 {
+				t.Error(name, "point outside hull", pnts[i])
+			}
+		}
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	var hull ConvexHull
+	var pnts []Point3
+
+	for i := 0; i < 8; i++ {
+		corner := Point3{-1, -1, -1}
+		for j := 0; j < 3; j++ {
+			if i&(1<<uint(j)) != 0 {
+				corner[j] = 1
+			}
+		}
+		// duplicates, and points on the faces and edges
+		pnts = append(pnts, corner, corner)
+		pnts = append(pnts, Point3{corner[x], corner[y], 0}, Point3{0, corner[y], corner[z]})
+	}
+	for i := 0; i < 50; i++ {
+		f := float32(i) / 50
+		pnts = append(pnts, Point3{f - 0.5, 0.8 - f, f * 0.5})
+	}
+
+	if !hull.Build(pnts, 0) {
+		t.Fatal("cube hull failed")
+	}
+	if len(hull.Vertices) != 8 || len(hull.Faces) != 12 {
+		t.Error("cube hull size", len(hull.Vertices), len(hull.Faces))
+	}
+	checkHull(t, "cube", &hull, pnts)
+
+	pnts = pnts[:0]
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			theta := float64(i) / 20 * 2 * math.Pi
+			phi := (float64(j) + 0.5) / 20 * math.Pi
+			pnts = append(pnts, Point3{
+				float32(math.Cos(theta) * math.Sin(phi)),
+				float32(math.Sin(theta) * math.Sin(phi)),
+				float32(math.Cos(phi))})
+		}
+	}
+	if !hull.Build(pnts, 0) {
+		t.Fatal("sphere hull failed")
+	}
+	if len(hull.Faces) != 2*len(hull.Vertices)-4 {
+		t.Error("sphere hull is not a closed triangle mesh", len(hull.Vertices), len(hull.Faces))
+	}
+	checkHull(t, "sphere", &hull, pnts)
+
+	if !hull.Build(pnts, 24) {
+		t.Fatal("simplified hull failed")
+	}
+	if len(hull.Vertices) > 24 {
+		t.Error("simplified hull has too many vertices", len(hull.Vertices))
+	}
+	checkHull(t, "simplified", &hull, nil)
+
+	var closest ClosestPoints
+	if closest.GJK(&hull, &Sphere{Center: Point3{3, 0, 0}, Radius: 1}) {
+		t.Error("hull and sphere should be separated")
+	}
+
+	flat := []Point3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}}
+	if hull.Build(flat, 0) {
+		t.Error("coplanar points should not build a hull")
+	}
+	if pnt := hull.Support(&Vector3{1, 0, 0}); pnt != (Point3{}) {
+		t.Error("empty hull support", pnt)
+	}
+}
+
+func TestTriangle(t *testing.T) {
+	tri := Triangle{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}}
+
+	var normal Vector3
+	tri.Normal(&normal)
+	if !v3NearlyEqual(&normal, &Vector3{0, 0, 1}) {
+		t.Error("triangle normal", normal)
+	}
+	if !nearlyEqual(tri.Area(), 2) {
+		t.Error("triangle area", tri.Area())
+	}
+	var centroid Point3
+	tri.Centroid(&centroid)
+	if !p3NearlyEqual(&centroid, &Point3{2.0 / 3.0, 2.0 / 3.0, 0}) {
+		t.Error("triangle centroid", centroid)
+	}
+
+	var bary Vector3
+	if !tri.Barycentric(&bary, &Point3{0.5, 1, 4}) || !v3NearlyEqual(&bary, &Vector3{0.25, 0.25, 0.5}) {
+		t.Error("triangle barycentric", bary)
+	}
+	if !tri.ContainsPoint(&Point3{0.5, 0.5, 1}) || tri.ContainsPoint(&Point3{1.5, 1.5, 0}) {
+		t.Error("triangle contains point")
+	}
+
+	var closest Point3
+	tri.ClosestPoint(&closest, &Point3{2, 2, 1})
+	if !p3NearlyEqual(&closest, &Point3{1, 1, 0}) {
+		t.Error("triangle closest point", closest)
+	}
+
+	if tri.IsDegenerate() {
+		t.Error("triangle reported degenerate")
+	}
+	sliver := Triangle{{0, 0, 0}, {1000, 0, 0}, {500, 1e-7, 0}}
+	if !sliver.IsDegenerate() || sliver.Barycentric(&bary, &Point3{}) {
+		t.Error("sliver not reported degenerate")
+	}
+	small := Triangle{{0, 0, 0}, {1e-4, 0, 0}, {0, 1e-4, 0}}
+	if small.IsDegenerate() {
+		t.Error("small triangle reported degenerate")
+	}
+
+	box := &AABB{Min: Point3{-1, -1, -1}, Max: Point3{1, 1, 1}}
+	tests := []struct {
+		tri      Triangle
+		overlaps bool
+	}{
+		{Triangle{{0, 0, 0}, {5, 0, 0}, {0, 5, 0}}, true},
+		{Triangle{{-5, -5, 0.5}, {5, -5, 0.5}, {0, 5, 0.5}}, true},
+		{Triangle{{2, 0, 0}, {3, 0, 0}, {2, 1, 0}}, false},
+		{Triangle{{-5, -5, 2}, {5, -5, 2}, {0, 5, 2}}, false},
+		{Triangle{{2.2, 0, -3}, {2.2, 0, 3}, {0, 2.2, 0}}, false},
+		{Triangle{{1.8, 0, -3}, {1.8, 0, 3}, {0, 1.8, 0}}, true},
+		// only an edge axis separates this one
+		{Triangle{{2.2, 0, 0}, {0, 2.2, 0}, {3, 3, 5}}, false},
+	}
+	for i, test := range tests {
+		if test.tri.OverlapsAABB(box) != test.overlaps {
+			t.Error("triangle aabb", i, test.overlaps)
+		}
+	}
+
+	var hit RayHit
+	ray := &Ray{Origin: Point3{0.5, 0.5, 5}, Direction: Vector3{0, 0, -1}}
+	if !tri.IntersectRay(ray, &hit) {
+		t.Error("triangle ray missed")
+	}
+	checkHit(t, "triangle ray", &hit, 5, &Point3{0.5, 0.5, 0}, &Vector3{0, 0, 1})
+}
+
+func checkContact(t *testing.T, name string, contact *Contact, normal *Vector3, depth float32) {
+	if !v3NearlyEqual(&contact.Normal, normal) {
+		t.Error(name, "normal", contact.Normal, "expected", *normal)
+	}
+	if !nearlyEqual(contact.Depth, depth) {
+		t.Error(name, "depth", contact.Depth, "expected", depth)
+	}
+}
+
+func TestCapsule(t *testing.T) {
+	seg := Segment{{0, 0, 0}, {4, 0, 0}}
+	if !nearlyEqual(seg.Length(), 4) {
+		t.Error("segment length", seg.Length())
+	}
+	var pnt Point3
+	seg.Lerp(&pnt, 0.25)
+	if !p3NearlyEqual(&pnt, &Point3{1, 0, 0}) {
+		t.Error("segment lerp", pnt)
+	}
+	seg.ClosestPoint(&pnt, &Point3{5, 3, 0})
+	if !p3NearlyEqual(&pnt, &Point3{4, 0, 0}) {
+		t.Error("segment closest point", pnt)
+	}
+
+	a := &Capsule{Segment: seg, Radius: 1}
+	a.ClosestPoint(&pnt, &Point3{7, 4, 0})
+	if !p3NearlyEqual(&pnt, &Point3{4.6, 0.8, 0}) {
+		t.Error("capsule closest point", pnt)
+	}
+	a.ClosestPoint(&pnt, &Point3{2, 0.5, 0})
+	if !p3NearlyEqual(&pnt, &Point3{2, 0.5, 0}) {
+		t.Error("capsule closest point inside", pnt)
+	}
+	var contact Contact
+
+	b := &Capsule{Segment: Segment{{2, 1.5, -3}, {2, 1.5, 3}}, Radius: 1}
+	if !contact.CapsuleCapsule(a, b) {
+		t.Error("capsules should overlap")
+	}
+	checkContact(t, "capsule capsule", &contact, &Vector3{0, 1, 0}, 0.5)
+	if !p3NearlyEqual(&contact.PointA, &Point3{2, 1, 0}) || !p3NearlyEqual(&contact.PointB, &Point3{2, 0.5, 0}) {
+		t.Error("capsule capsule points", contact.PointA, contact.PointB)
+	}
+	b.Segment = Segment{{2, 2.5, -3}, {2, 2.5, 3}}
+	if contact.CapsuleCapsule(a, b) {
+		t.Error("capsules shouldn't overlap")
+	}
+
+	if !contact.CapsuleSphere(a, &Sphere{Center: Point3{5, 0, 0}, Radius: 0.5}) {
+		t.Error("capsule and sphere should overlap")
+	}
+	checkContact(t, "capsule sphere", &contact, &Vector3{1, 0, 0}, 0.5)
+	if contact.CapsuleSphere(a, &Sphere{Center: Point3{2, 0, 3}, Radius: 1}) {
+		t.Error("capsule and sphere shouldn't overlap")
+	}
+
+	box := &AABB{Min: Point3{1, -3, -1}, Max: Point3{3, -0.5, 1}}
+	if !contact.CapsuleAABB(a, box) {
+		t.Error("capsule and box should overlap")
+	}
+	checkContact(t, "capsule aabb", &contact, &Vector3{0, -1, 0}, 0.5)
+	box = &AABB{Min: Point3{1, -1, -1}, Max: Point3{3, 1, 0.25}}
+	if !contact.CapsuleAABB(a, box) {
+		t.Error("capsule segment inside box should overlap")
+	}
+	checkContact(t, "capsule aabb deep", &contact, &Vector3{0, 0, -1}, 1.25)
+	// a flat box touching the segment along its length leaves EPA without
+	// a normal
+	box = &AABB{Min: Point3{1, 0, -1}, Max: Point3{3, 0, 1}}
+	if !contact.CapsuleAABB(a, box) {
+		t.Error("capsule touching flat box should overlap")
+	}
+	checkContact(t, "capsule aabb touching", &contact, &Vector3{0, -1, 0}, 1)
+	box = &AABB{Min: Point3{1, 1.5, -1}, Max: Point3{3, 3, 1}}
+	if contact.CapsuleAABB(a, box) {
+		t.Error("capsule and box shouldn't overlap")
+	}
+
+	tri := &Triangle{{0, -2, -2}, {0, 2, -2}, {0, 0, 2}}
+	c := &Capsule{Segment: Segment{{-1, 0, 0}, {3, 0, 0}}, Radius: 0.5}
+	if !contact.CapsuleTriangle(c, tri) {
+		t.Error("capsule through triangle should overlap")
+	}
+	checkContact(t, "capsule triangle crossing", &contact, &Vector3{-1, 0, 0}, 1.5)
+	c.Segment = Segment{{0.25, 0, 0}, {3, 0, 0}}
+	if !contact.CapsuleTriangle(c, tri) {
+		t.Error("capsule near triangle should overlap")
+	}
+	checkContact(t, "capsule triangle", &contact, &Vector3{-1, 0, 0}, 0.25)
+	c.Segment = Segment{{1, 0, 0}, {3, 0, 0}}
+	if contact.CapsuleTriangle(c, tri) {
+		t.Error("capsule and triangle shouldn't overlap")
+	}
+
+	var cp ClosestPoints
+	cp.GJK(a, &Sphere{Center: Point3{2, 4, 0}, Radius: 1})
+	if !nearlyEqual(cp.DistSqr, 4) {
+		t.Error("capsule support distance", cp.DistSqr)
+	}
+}
+
+func checkSweep(t *testing.T, name string, hit *SweepHit, time float32, normal *Vector3, pnt *Point3) {
+	if !nearlyEqual(hit.Time, time) {
+		t.Error(name, "time", hit.Time, "expected", time)
+	}
+	if !v3NearlyEqual(&hit.Normal, normal) {
+		t.Error(name, "normal", hit.Normal, "expected", *normal)
+	}
+	if pnt != nil && !p3NearlyEqual(&hit.Point, pnt) {
+		t.Error(name, "point", hit.Point, "expected", *pnt)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	var hit SweepHit
+	var vel Vector3
+	vel.Velocity(&Vector3{0, 10, 0}, &Vector3{0, 0, 0}, 2)
+	if !v3NearlyEqual(&vel, &Vector3{0, -5, 0}) {
+		t.Fatal("velocity", vel)
+	}
+
+	sphere := &Sphere{Center: Point3{0, 10, 0}, Radius: 1}
+	plane := &Plane{0, 1, 0, 0}
+	if !hit.SpherePlane(sphere, &vel, plane, 10) {
+		t.Error("sphere should hit plane")
+	}
+	checkSweep(t, "sphere plane", &hit, 1.8, &Vector3{0, 1, 0}, &Point3{0, 0, 0})
+	if hit.SpherePlane(sphere, &vel, plane, 1) {
+		t.Error("sphere shouldn't reach plane in time")
+	}
+
+	// thin wall crossed in a single step
+	tri := &Triangle{{-5, 0, -5}, {0, 0, 5}, {5, 0, -5}}
+	bullet := &Sphere{Center: Point3{0, 3, 0}, Radius: 0.1}
+	fast := &Vector3{0, -100, 0}
+	if !hit.SphereTriangle(bullet, fast, tri, 1) {
+		t.Error("bullet should hit triangle")
+	}
+	checkSweep(t, "sphere triangle face", &hit, 0.029, &Vector3{0, 1, 0}, &Point3{0, 0, 0})
+	edge := &Sphere{Center: Point3{0, 0.5, 6}, Radius: 1}
+	if !hit.SphereTriangle(edge, &Vector3{0, 0, -1}, tri, 10) {
+		t.Error("sphere should hit triangle edge")
+	}
+	checkSweep(t, "sphere triangle edge", &hit, 1-float32(math.Sqrt(0.75)), &Vector3{0, 0.5, float32(math.Sqrt(0.75))}, &Point3{0, 0, 5})
+	if hit.SphereTriangle(&Sphere{Center: Point3{8, 3, 0}, Radius: 1}, fast, tri, 1) {
+		t.Error("sphere beside triangle shouldn't hit")
+	}
+
+	box := &AABB{Min: Point3{-1, -1, -1}, Max: Point3{1, 1, 1}}
+	still := &Vector3{}
+	if !hit.SphereAABB(&Sphere{Center: Point3{5, 0, 0}, Radius: 1}, &Vector3{-1, 0, 0}, box, still, 10) {
+		t.Error("sphere should hit box face")
+	}
+	checkSweep(t, "sphere aabb face", &hit, 3, &Vector3{1, 0, 0}, &Point3{1, 0, 0})
+	if !hit.SphereAABB(&Sphere{Center: Point3{5, 5, 0}, Radius: 1}, &Vector3{-1, -1, 0}, box, &Vector3{1, 1, 0}, 10) {
+		t.Error("sphere should hit moving box edge")
+	}
+	edgeTime := (4 - float32(math.Sqrt(0.5))) / 2
+	checkSweep(t, "sphere aabb edge", &hit, edgeTime, &Vector3{float32(math.Sqrt(0.5)), float32(math.Sqrt(0.5)), 0},
+		&Point3{1 + edgeTime, 1 + edgeTime, 0})
+	if hit.SphereAABB(&Sphere{Center: Point3{5, 5, 0}, Radius: 1}, &Vector3{-1, 0, 0}, box, still, 10) {
+		t.Error("sphere shouldn't hit box")
+	}
+
+	a := &Sphere{Center: Point3{-5, 0, 0}, Radius: 1}
+	b := &Sphere{Center: Point3{5, 0, 0}, Radius: 2}
+	if !hit.SphereSphere(a, &Vector3{1, 0, 0}, b, &Vector3{-1, 0, 0}, 10) {
+		t.Error("spheres should hit")
+	}
+	checkSweep(t, "sphere sphere", &hit, 3.5, &Vector3{-1, 0, 0}, &Point3{-0.5, 0, 0})
+
+	if !hit.AABBPlane(box, &Vector3{0, -2, 0}, &Plane{0, 1, 0, 3}, 10) {
+		t.Error("box should hit plane")
+	}
+	checkSweep(t, "aabb plane", &hit, 1, &Vector3{0, 1, 0}, nil)
+	if hit.Point[y] != -3 {
+		t.Error("aabb plane point", hit.Point)
+	}
+
+	other := &AABB{Min: Point3{4, -0.5, -0.5}, Max: Point3{5, 0.5, 0.5}}
+	if !hit.AABBAABB(box, &Vector3{2, 0, 0}, other, &Vector3{-1, 0, 0}, 10) {
+		t.Error("boxes should hit")
+	}
+	checkSweep(t, "aabb aabb", &hit, 1, &Vector3{-1, 0, 0}, &Point3{3, 0, 0})
+	if hit.AABBAABB(box, &Vector3{2, 0, 0}, other, &Vector3{2, 0, 0}, 10) {
+		t.Error("boxes moving together shouldn't hit")
+	}
+
+	if !hit.AABBTriangle(&AABB{Min: Point3{-0.1, 2, -0.1}, Max: Point3{0.1, 2.2, 0.1}}, fast, tri, 1) {
+		t.Error("box should hit triangle")
+	}
+	checkSweep(t, "aabb triangle", &hit, 0.02, &Vector3{0, 1, 0}, nil)
+	if hit.AABBTriangle(&AABB{Min: Point3{7, 2, 0}, Max: Point3{8, 3, 1}}, fast, tri, 1) {
+		t.Error("box beside triangle shouldn't hit")
+	}
+
+	// a long thin box spinning about z sweeps into a sphere beside it
+	rod := &AABB{Min: Point3{-2, -0.1, -0.1}, Max: Point3{2, 0.1, 0.1}}
+	target := &Sphere{Radius: 0.5}
+	var motionA, motionB Motion
+	motionA.Rotation.MakeIdentity()
+	motionA.AngularVelocity = Vector3{0, 0, 1}
+	motionB.Rotation.MakeIdentity()
+	motionB.Position = Point3{0, 1.5, 0}
+	if !hit.ConservativeAdvancement(rod, &motionA, target, &motionB, 3) {
+		t.Fatal("spinning rod should hit sphere")
+	}
+	var tfrm Transform3
+	motionA.Transform(&tfrm, hit.Time)
+	var cp ClosestPoints
+	cp.GJK(&TransformedSupport{Shape: rod, Transform: tfrm}, &Sphere{Center: motionB.Position, Radius: 0.5})
+	if cp.DistSqr > 1e-4 || hit.Time <= 1 || hit.Time > 1.2 {
+		t.Error("conservative advancement time", hit.Time, cp.DistSqr)
+	}
+	motionA.AngularVelocity = Vector3{1, 0, 0}
+	if hit.ConservativeAdvancement(rod, &motionA, target, &motionB, 3) {
+		t.Error("rod spinning about its length shouldn't hit sphere")
+	}
+
+	// spinning fast about its length while drifting in, the bound on
+	// angular approach is too loose to converge within the iteration limit
+	motionA.AngularVelocity = Vector3{100, 0, 0}
+	motionA.LinearVelocity = Vector3{0, 1, 0}
+	if hit.ConservativeAdvancement(rod, &motionA, target, &motionB, 1000) {
+		t.Error("conservative advancement should give up when it doesn't converge", hit.Time)
+	}
+
+	// overlapping at the start
+	motionA.AngularVelocity = Vector3{}
+	motionB.Position = Point3{1, 0.5, 0}
+	if !hit.ConservativeAdvancement(rod, &motionA, target, &motionB, 3) {
+		t.Fatal("overlapping shapes should hit")
+	}
+	if hit.Time != 0 || !v3NearlyEqual(&hit.Normal, &Vector3{0, -1, 0}) || hit.Point.Dist(&Point3{1, 0, 0}) > 0.01 {
+		t.Error("conservative advancement initial overlap", hit.Time, hit.Normal, hit.Point)
+	}
+}
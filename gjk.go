@@ -0,0 +1,573 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+)
+
+// Support is implemented by convex shapes.  Support returns the point of
+// the shape furthest along dir, which need not be unit length.
+type Support interface {
+	Support(dir *Vector3) Point3
+}
+
+// TransformedSupport places a convex shape defined in local space into
+// the world with an affine transform
+type TransformedSupport struct {
+	Shape     Support
+	Transform Transform3
+}
+
+func (t *TransformedSupport) Support(dir *Vector3) Point3 {
+	var upper Matrix3
+	var localDir Vector3
+
+	// the support of a linearly mapped shape is found by searching along
+	// the transposed direction
+	t.Transform.Upper3x3(&upper)
+	localDir.RowMulMat3(dir, &upper)
+	result := t.Shape.Support(&localDir)
+	result.MulT3Self(&t.Transform)
+	return result
+}
+
+func (s *Sphere) Support(dir *Vector3) Point3 {
+	var offset Vector3
+	result := s.Center
+	lenSqr := dir.LengthSqr()
+	if lenSqr < g_EPSILON*g_EPSILON {
+		return result
+	}
+	offset.ScalarMul(dir, s.Radius/sqrt(lenSqr))
+	result.AddV3ToSelf(&offset)
+	return result
+}
+
+func (a *AABB) Support(dir *Vector3) Point3 {
+	var result Point3
+	for i := 0; i < 3; i++ {
+		if dir[i] >= 0.0 {
+			result[i] = a.Max[i]
+		} else {
+			result[i] = a.Min[i]
+		}
+	}
+	return result
+}
+
+func (b *OBB) Support(dir *Vector3) Point3 {
+	var axis Vector3
+	result := b.Center
+	for i := 0; i < 3; i++ {
+		b.Axes.Col(&axis, i)
+		if dir.Dot(&axis) >= 0.0 {
+			axis.ScalarMulSelf(b.HalfExtents[i])
+		} else {
+			axis.ScalarMulSelf(-b.HalfExtents[i])
+		}
+		result.AddV3ToSelf(&axis)
+	}
+	return result
+}
+
+const (
+	gjkMaxIterations = 64
+	gjkTolerance     = 1e-6
+	epaMaxIterations = 64
+	epaTolerance     = 1e-4
+)
+
+// simplexVertex is a point of the Minkowski difference A - B, along with
+// the support points on A and B that produced it
+type simplexVertex struct {
+	w    Vector3
+	a, b Point3
+}
+
+func (result *simplexVertex) support(shapeA, shapeB Support, dir *Vector3) {
+	var negDir Vector3
+	negDir.Neg(dir)
+	result.a = shapeA.Support(dir)
+	result.b = shapeB.Support(&negDir)
+	result.w.P3Sub(&result.a, &result.b)
+}
+
+type simplex struct {
+	verts  [4]simplexVertex
+	lambda [4]float32
+	count  int
+}
+
+func (s *simplex) keep(indices ...int) {
+	var verts [4]simplexVertex
+	for i, idx := range indices {
+		verts[i] = s.verts[idx]
+	}
+	s.verts = verts
+	s.count = len(indices)
+}
+
+// closest reduces the simplex to the smallest feature containing the
+// point closest to the origin, sets the barycentric weights of that point
+// and stores it in v.  It returns true if the origin is inside a
+// tetrahedral simplex.
+func (s *simplex) closest(v *Vector3) bool {
+	switch s.count {
+	case 1:
+		s.lambda[0] = 1.0
+	case 2:
+		s.closestSegment()
+	case 3:
+		s.closestTriangle()
+	case 4:
+		if s.closestTetrahedron() {
+			return true
+		}
+	}
+
+	*v = Vector3{}
+	var tmpV3 Vector3
+	for i := 0; i < s.count; i++ {
+		tmpV3.ScalarMul(&s.verts[i].w, s.lambda[i])
+		v.AddToSelf(&tmpV3)
+	}
+	return false
+}
+
+func (s *simplex) closestSegment() {
+	var ab Vector3
+	ab.Sub(&s.verts[1].w, &s.verts[0].w)
+	lenSqr := ab.LengthSqr()
+	t := float32(0.0)
+	if lenSqr > g_EPSILON*g_EPSILON {
+		t = -s.verts[0].w.Dot(&ab) / lenSqr
+	}
+	switch {
+	case t <= 0.0:
+		s.keep(0)
+		s.lambda[0] = 1.0
+	case t >= 1.0:
+		s.keep(1)
+		s.lambda[0] = 1.0
+	default:
+		s.lambda[0] = 1.0 - t
+		s.lambda[1] = t
+	}
+}
+
+// closestTriangle is the Voronoi region test from
+// ClosestPoints.PointTriangle with the origin as the query point
+func (s *simplex) closestTriangle() {
+	var ab, ac, ap, bp, cp Vector3
+	a, b, c := &s.verts[0].w, &s.verts[1].w, &s.verts[2].w
+
+	ab.Sub(b, a)
+	ac.Sub(c, a)
+	ap.Neg(a)
+	d1 := ab.Dot(&ap)
+	d2 := ac.Dot(&ap)
+	if d1 <= 0.0 && d2 <= 0.0 {
+		s.keep(0)
+		s.lambda[0] = 1.0
+		return
+	}
+
+	bp.Neg(b)
+	d3 := ab.Dot(&bp)
+	d4 := ac.Dot(&bp)
+	if d3 >= 0.0 && d4 <= d3 {
+		s.keep(1)
+		s.lambda[0] = 1.0
+		return
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0.0 && d1 >= 0.0 && d3 <= 0.0 {
+		t := d1 / (d1 - d3)
+		s.keep(0, 1)
+		s.lambda[0] = 1.0 - t
+		s.lambda[1] = t
+		return
+	}
+
+	cp.Neg(c)
+	d5 := ab.Dot(&cp)
+	d6 := ac.Dot(&cp)
+	if d6 >= 0.0 && d5 <= d6 {
+		s.keep(2)
+		s.lambda[0] = 1.0
+		return
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0.0 && d2 >= 0.0 && d6 <= 0.0 {
+		t := d2 / (d2 - d6)
+		s.keep(0, 2)
+		s.lambda[0] = 1.0 - t
+		s.lambda[1] = t
+		return
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0.0 && (d4-d3) >= 0.0 && (d5-d6) >= 0.0 {
+		t := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		s.keep(1, 2)
+		s.lambda[0] = 1.0 - t
+		s.lambda[1] = t
+		return
+	}
+
+	denom := 1.0 / (va + vb + vc)
+	s.lambda[1] = vb * denom
+	s.lambda[2] = vc * denom
+	s.lambda[0] = 1.0 - s.lambda[1] - s.lambda[2]
+}
+
+// closestTetrahedron tests each face the origin lies outside of, keeping
+// the closest.  It returns true if the origin is inside.
+func (s *simplex) closestTetrahedron() bool {
+	faces := [4][4]int{{0, 1, 2, 3}, {0, 2, 3, 1}, {0, 3, 1, 2}, {1, 3, 2, 0}}
+	var best simplex
+	var v Vector3
+	bestDist := float32(-1.0)
+
+	for _, f := range faces {
+		if !originOutsideFace(&s.verts[f[0]].w, &s.verts[f[1]].w, &s.verts[f[2]].w, &s.verts[f[3]].w) {
+			continue
+		}
+		face := simplex{count: 3}
+		face.verts[0] = s.verts[f[0]]
+		face.verts[1] = s.verts[f[1]]
+		face.verts[2] = s.verts[f[2]]
+		face.closest(&v)
+		if dist := v.LengthSqr(); bestDist < 0.0 || dist < bestDist {
+			bestDist = dist
+			best = face
+		}
+	}
+
+	if bestDist < 0.0 {
+		return true
+	}
+	*s = best
+	return false
+}
+
+// originOutsideFace reports whether the origin is on the opposite side of
+// the plane through a, b, c from d.  Degenerate tetrahedra report every face.
+func originOutsideFace(a, b, c, d *Vector3) bool {
+	var ab, ac, ad, n Vector3
+	ab.Sub(b, a)
+	ac.Sub(c, a)
+	ad.Sub(d, a)
+	n.Cross(&ab, &ac)
+	signD := ad.Dot(&n)
+	if abs(signD) < g_EPSILON*g_EPSILON {
+		return true
+	}
+	signP := -a.Dot(&n)
+	return signP*signD < 0.0
+}
+
+// gjk runs the Gilbert-Johnson-Keerthi distance algorithm over the
+// Minkowski difference A - B.  It returns true if the shapes overlap, along
+// with the final simplex and the closest point of A - B to the origin.
+func gjk(shapeA, shapeB Support, s *simplex, v *Vector3) bool {
+	var vert simplexVertex
+
+	*v = Vector3{1, 0, 0}
+	s.count = 1
+	s.verts[0].support(shapeA, shapeB, v)
+	s.lambda[0] = 1.0
+	*v = s.verts[0].w
+
+	prevDist := float32(math.MaxFloat32)
+	for i := 0; i < gjkMaxIterations; i++ {
+		dist := v.LengthSqr()
+		if dist <= gjkTolerance*gjkTolerance {
+			return true
+		}
+		if dist >= prevDist {
+			// no progress, numerical limit reached
+			return false
+		}
+		prevDist = dist
+
+		var dir Vector3
+		dir.Neg(v)
+		vert.support(shapeA, shapeB, &dir)
+
+		if dist-v.Dot(&vert.w) <= gjkTolerance*dist {
+			return false
+		}
+
+		s.verts[s.count] = vert
+		s.count++
+		if s.closest(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// GJK computes the closest points between two convex shapes, returning
+// true if they overlap.  When they overlap the closest points are
+// meaningless; use Contact.EPA for the penetration.
+func (result *ClosestPoints) GJK(shapeA, shapeB Support) bool {
+	var s simplex
+	var v Vector3
+
+	if gjk(shapeA, shapeB, &s, &v) {
+		result.DistSqr = 0.0
+		return true
+	}
+
+	var tmpV3 Vector3
+	result.PointA = Point3{}
+	result.PointB = Point3{}
+	for i := 0; i < s.count; i++ {
+		tmpV3.MakeFromP3(&s.verts[i].a)
+		tmpV3.ScalarMulSelf(s.lambda[i])
+		result.PointA.AddV3ToSelf(&tmpV3)
+		tmpV3.MakeFromP3(&s.verts[i].b)
+		tmpV3.ScalarMulSelf(s.lambda[i])
+		result.PointB.AddV3ToSelf(&tmpV3)
+	}
+	result.finish()
+	return false
+}
+
+// Contact describes the penetration of two overlapping shapes.  Normal is
+// the unit direction from A toward B; moving B by Normal * Depth separates
+// them.  PointA is the deepest point of A inside B, and PointB the deepest
+// point of B inside A.
+type Contact struct {
+	Normal         Vector3
+	Depth          float32
+	PointA, PointB Point3
+}
+
+type epaFace struct {
+	v      [3]int
+	normal Vector3
+	dist   float32
+}
+
+type epaEdge [2]int
+
+// EPA runs GJK and, if the shapes overlap, expands the final simplex with
+// the Expanding Polytope Algorithm to find the penetration.  It returns
+// false if the shapes do not overlap.
+func (result *Contact) EPA(shapeA, shapeB Support) bool {
+	var s simplex
+	var v Vector3
+
+	if !gjk(shapeA, shapeB, &s, &v) {
+		return false
+	}
+	if !s.expandToTetrahedron(shapeA, shapeB) {
+		// flat Minkowski difference, the shapes are only touching
+		*result = Contact{}
+		return true
+	}
+
+	verts := make([]simplexVertex, 4, 4+epaMaxIterations)
+	copy(verts, s.verts[:])
+
+	var centroid Vector3
+	for i := range verts {
+		centroid.AddToSelf(&verts[i].w)
+	}
+	centroid.ScalarMulSelf(0.25)
+
+	faces := make([]epaFace, 0, 4+2*epaMaxIterations)
+	for _, f := range [4][3]int{{0, 1, 2}, {0, 3, 1}, {0, 2, 3}, {1, 3, 2}} {
+		faces = append(faces, newEPAFace(verts, f[0], f[1], f[2], &centroid))
+	}
+
+	var closest int
+	var edges []epaEdge
+	for iter := 0; iter < epaMaxIterations; iter++ {
+		closest = 0
+		for i := range faces {
+			if faces[i].dist < faces[closest].dist {
+				closest = i
+			}
+		}
+
+		var vert simplexVertex
+		vert.support(shapeA, shapeB, &faces[closest].normal)
+		if vert.w.Dot(&faces[closest].normal)-faces[closest].dist < epaTolerance {
+			break
+		}
+
+		// remove every face the new point can see, remembering the
+		// horizon edges that bound the hole
+		verts = append(verts, vert)
+		newIndex := len(verts) - 1
+		edges = edges[:0]
+		kept := faces[:0]
+		for _, f := range faces {
+			var toVert Vector3
+			toVert.Sub(&vert.w, &verts[f.v[0]].w)
+			if f.normal.Dot(&toVert) <= 0.0 {
+				kept = append(kept, f)
+				continue
+			}
+			for j := 0; j < 3; j++ {
+				edges = addHorizonEdge(edges, epaEdge{f.v[j], f.v[(j+1)%3]})
+			}
+		}
+		faces = kept
+		for _, e := range edges {
+			faces = append(faces, newEPAFace(verts, e[0], e[1], newIndex, &centroid))
+		}
+	}
+
+	closest = 0
+	for i := range faces {
+		if faces[i].dist < faces[closest].dist {
+			closest = i
+		}
+	}
+	face := &faces[closest]
+
+	// barycentric coordinates of the origin's projection onto the face
+	var projection Vector3
+	var tri simplex
+	projection.ScalarMul(&face.normal, face.dist)
+	for i := 0; i < 3; i++ {
+		tri.verts[i] = verts[face.v[i]]
+		tri.verts[i].w.SubFromSelf(&projection)
+	}
+	tri.count = 3
+	tri.closest(&v)
+
+	result.Normal = face.normal
+	result.Depth = face.dist
+	result.PointA = Point3{}
+	result.PointB = Point3{}
+	var tmpV3 Vector3
+	for i := 0; i < tri.count; i++ {
+		tmpV3.MakeFromP3(&tri.verts[i].a)
+		tmpV3.ScalarMulSelf(tri.lambda[i])
+		result.PointA.AddV3ToSelf(&tmpV3)
+		tmpV3.MakeFromP3(&tri.verts[i].b)
+		tmpV3.ScalarMulSelf(tri.lambda[i])
+		result.PointB.AddV3ToSelf(&tmpV3)
+	}
+	return true
+}
+
+// newEPAFace builds a face oriented so its normal points away from the
+// interior point centroid
+func newEPAFace(verts []simplexVertex, i0, i1, i2 int, centroid *Vector3) epaFace {
+	var ab, ac, toFace Vector3
+	f := epaFace{v: [3]int{i0, i1, i2}}
+
+	ab.Sub(&verts[i1].w, &verts[i0].w)
+	ac.Sub(&verts[i2].w, &verts[i0].w)
+	f.normal.Cross(&ab, &ac)
+	toFace.Sub(&verts[i0].w, centroid)
+	if f.normal.Dot(&toFace) < 0.0 {
+		f.v[1], f.v[2] = f.v[2], f.v[1]
+		f.normal.NegSelf()
+	}
+	lenSqr := f.normal.LengthSqr()
+	if lenSqr > 0.0 {
+		f.normal.ScalarMulSelf(1.0 / sqrt(lenSqr))
+	}
+	f.dist = f.normal.Dot(&verts[i0].w)
+	return f
+}
+
+// addHorizonEdge adds an edge to the horizon, or cancels it against its
+// reverse if the neighbouring face was also removed
+func addHorizonEdge(edges []epaEdge, e epaEdge) []epaEdge {
+	for i := range edges {
+		if edges[i][0] == e[1] && edges[i][1] == e[0] {
+			edges[i] = edges[len(edges)-1]
+			return edges[:len(edges)-1]
+		}
+	}
+	return append(edges, e)
+}
+
+// expandToTetrahedron grows a GJK simplex that ended on a vertex, edge or
+// face of the origin into a tetrahedron enclosing it.  It returns false if
+// the Minkowski difference is flat.
+func (s *simplex) expandToTetrahedron(shapeA, shapeB Support) bool {
+	axes := [3]Vector3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	var dir, edge, tmpV3 Vector3
+
+	if s.count == 1 {
+		for i := range axes {
+			s.verts[1].support(shapeA, shapeB, &axes[i])
+			tmpV3.Sub(&s.verts[1].w, &s.verts[0].w)
+			if tmpV3.LengthSqr() > g_EPSILON {
+				break
+			}
+			dir.Neg(&axes[i])
+			s.verts[1].support(shapeA, shapeB, &dir)
+			tmpV3.Sub(&s.verts[1].w, &s.verts[0].w)
+			if tmpV3.LengthSqr() > g_EPSILON {
+				break
+			}
+		}
+		s.count = 2
+	}
+
+	if s.count == 2 {
+		edge.Sub(&s.verts[1].w, &s.verts[0].w)
+		// search perpendicular to the edge, starting from the axis least
+		// aligned with it
+		best := 0
+		for i := 1; i < 3; i++ {
+			if abs(edge[i]) < abs(edge[best]) {
+				best = i
+			}
+		}
+		dir.Cross(&edge, &axes[best])
+		var rot Matrix3
+		tmpV3.Normalize(&edge)
+		rot.MakeRotationAxis(math.Pi/3.0, &tmpV3)
+		for i := 0; i < 6; i++ {
+			s.verts[2].support(shapeA, shapeB, &dir)
+			if triangleArea(&s.verts[0].w, &s.verts[1].w, &s.verts[2].w) > g_EPSILON {
+				break
+			}
+			dir.MulM3Self(&rot)
+		}
+		s.count = 3
+	}
+
+	if s.count == 3 {
+		var ab, ac Vector3
+		ab.Sub(&s.verts[1].w, &s.verts[0].w)
+		ac.Sub(&s.verts[2].w, &s.verts[0].w)
+		dir.Cross(&ab, &ac)
+		s.verts[3].support(shapeA, shapeB, &dir)
+		tmpV3.Sub(&s.verts[3].w, &s.verts[0].w)
+		if abs(tmpV3.Dot(&dir)) < g_EPSILON {
+			dir.NegSelf()
+			s.verts[3].support(shapeA, shapeB, &dir)
+			tmpV3.Sub(&s.verts[3].w, &s.verts[0].w)
+			if abs(tmpV3.Dot(&dir)) < g_EPSILON {
+				return false
+			}
+		}
+		s.count = 4
+	}
+	return true
+}
+
+func triangleArea(a, b, c *Vector3) float32 {
+	var ab, ac, n Vector3
+	ab.Sub(b, a)
+	ac.Sub(c, a)
+	n.Cross(&ab, &ac)
+	return 0.5 * n.Length()
+}
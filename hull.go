@@ -0,0 +1,317 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// ConvexHull is a closed triangle mesh enclosing a point cloud
+type ConvexHull struct {
+	Vertices []Point3
+	Faces    []HullFace
+}
+
+// HullFace is a hull triangle wound counter-clockwise when seen from
+// outside.  Adjacent[i] is the index of the face sharing the edge from
+// Indices[i] to Indices[(i+1)%3].
+type HullFace struct {
+	Indices  [3]int
+	Plane    Plane
+	Adjacent [3]int
+}
+
+type quickhullFace struct {
+	HullFace
+	outside []int
+	deleted bool
+}
+
+type quickhull struct {
+	pnts  []Point3
+	faces []quickhullFace
+	used  []bool
+	eps   float32
+}
+
+// Build computes the convex hull of pnts with the quickhull algorithm.
+// Points within a small tolerance of a face, including duplicates, are
+// treated as lying on it.  If maxVertices is 4 or more, the hull is
+// simplified by stopping once it has that many vertices; since the
+// furthest points are added first it keeps the overall shape.  Build
+// returns false if the points are all coplanar.
+func (result *ConvexHull) Build(pnts []Point3, maxVertices int) bool {
+	qh := quickhull{pnts: pnts, used: make([]bool, len(pnts))}
+	if !qh.initialSimplex() {
+		result.Vertices = result.Vertices[:0]
+		result.Faces = result.Faces[:0]
+		return false
+	}
+
+	vertexCount := 4
+	for i := 0; i < len(qh.faces); i++ {
+		if maxVertices >= 4 && vertexCount >= maxVertices {
+			break
+		}
+		if qh.faces[i].deleted || len(qh.faces[i].outside) == 0 {
+			continue
+		}
+		qh.addPoint(i)
+		vertexCount++
+	}
+
+	result.compact(&qh)
+	return true
+}
+
+// initialSimplex builds a tetrahedron from extreme points and assigns
+// every other point to the outside set of a face it is in front of
+func (qh *quickhull) initialSimplex() bool {
+	if len(qh.pnts) < 4 {
+		return false
+	}
+
+	var minIdx, maxIdx [3]int
+	var maxAbs Vector3
+	for i := range qh.pnts {
+		for j := 0; j < 3; j++ {
+			if qh.pnts[i][j] < qh.pnts[minIdx[j]][j] {
+				minIdx[j] = i
+			}
+			if qh.pnts[i][j] > qh.pnts[maxIdx[j]][j] {
+				maxIdx[j] = i
+			}
+			maxAbs[j] = max(maxAbs[j], abs(qh.pnts[i][j]))
+		}
+	}
+	qh.eps = 3.0 * 1.1920929e-07 * maxAbs.Sum()
+
+	// the two extremes furthest apart
+	var i0, i1 int
+	bestDist := float32(-1.0)
+	for j := 0; j < 3; j++ {
+		if d := qh.pnts[minIdx[j]].DistSqr(&qh.pnts[maxIdx[j]]); d > bestDist {
+			bestDist = d
+			i0, i1 = minIdx[j], maxIdx[j]
+		}
+	}
+	if bestDist <= qh.eps*qh.eps {
+		return false
+	}
+
+	// the point furthest from that line
+	var cp ClosestPoints
+	i2 := -1
+	bestDist = qh.eps * qh.eps
+	for i := range qh.pnts {
+		cp.PointSegment(&qh.pnts[i], &qh.pnts[i0], &qh.pnts[i1])
+		if cp.DistSqr > bestDist {
+			bestDist = cp.DistSqr
+			i2 = i
+		}
+	}
+	if i2 < 0 {
+		return false
+	}
+
+	// the point furthest from that plane
+	var plane Plane
+	plane.MakeFromPoints(&qh.pnts[i0], &qh.pnts[i1], &qh.pnts[i2])
+	i3 := -1
+	bestDist = qh.eps
+	for i := range qh.pnts {
+		if d := abs(plane.Dist(&qh.pnts[i])); d > bestDist {
+			bestDist = d
+			i3 = i
+		}
+	}
+	if i3 < 0 {
+		return false
+	}
+
+	if plane.Dist(&qh.pnts[i3]) > 0.0 {
+		i1, i2 = i2, i1
+	}
+	qh.used[i0], qh.used[i1], qh.used[i2], qh.used[i3] = true, true, true, true
+
+	qh.faces = qh.faces[:0]
+	qh.newFace(i0, i1, i2)
+	qh.newFace(i0, i3, i1)
+	qh.newFace(i1, i3, i2)
+	qh.newFace(i2, i3, i0)
+	qh.linkFaces()
+
+	unassigned := make([]int, 0, len(qh.pnts))
+	for i := range qh.pnts {
+		if !qh.used[i] {
+			unassigned = append(unassigned, i)
+		}
+	}
+	qh.assign(unassigned, 0)
+	return true
+}
+
+func (qh *quickhull) newFace(i0, i1, i2 int) int {
+	f := quickhullFace{}
+	f.Indices = [3]int{i0, i1, i2}
+	f.Adjacent = [3]int{-1, -1, -1}
+	f.Plane.MakeFromPoints(&qh.pnts[i0], &qh.pnts[i1], &qh.pnts[i2])
+	qh.faces = append(qh.faces, f)
+	return len(qh.faces) - 1
+}
+
+// linkFaces fills in adjacency by matching each edge with its reverse
+func (qh *quickhull) linkFaces() {
+	edges := make(map[[2]int]int)
+	for i := range qh.faces {
+		for j := 0; j < 3; j++ {
+			edges[[2]int{qh.faces[i].Indices[j], qh.faces[i].Indices[(j+1)%3]}] = i
+		}
+	}
+	for i := range qh.faces {
+		for j := 0; j < 3; j++ {
+			qh.faces[i].Adjacent[j] = edges[[2]int{qh.faces[i].Indices[(j+1)%3], qh.faces[i].Indices[j]}]
+		}
+	}
+}
+
+// assign moves each point to the outside set of the first face from
+// firstFace on that it is in front of.  Points behind every face are
+// inside the hull and dropped.
+func (qh *quickhull) assign(pnts []int, firstFace int) {
+	for _, p := range pnts {
+		if qh.used[p] {
+			continue
+		}
+		for i := firstFace; i < len(qh.faces); i++ {
+			if qh.faces[i].deleted {
+				continue
+			}
+			if qh.faces[i].Plane.Dist(&qh.pnts[p]) > qh.eps {
+				qh.faces[i].outside = append(qh.faces[i].outside, p)
+				break
+			}
+		}
+	}
+}
+
+// addPoint adds the furthest outside point of a face to the hull
+func (qh *quickhull) addPoint(face int) {
+	eye := -1
+	bestDist := float32(0.0)
+	for _, p := range qh.faces[face].outside {
+		if d := qh.faces[face].Plane.Dist(&qh.pnts[p]); d > bestDist {
+			bestDist = d
+			eye = p
+		}
+	}
+	qh.used[eye] = true
+
+	// find the faces the eye can see, and the horizon of edges where they
+	// meet faces it cannot
+	var visible []int
+	var horizon [][3]int // start vertex, end vertex, face across the edge
+	stack := []int{face}
+	qh.faces[face].deleted = true
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		visible = append(visible, f)
+		for j := 0; j < 3; j++ {
+			n := qh.faces[f].Adjacent[j]
+			if qh.faces[n].deleted {
+				continue
+			}
+			if qh.faces[n].Plane.Dist(&qh.pnts[eye]) > qh.eps {
+				qh.faces[n].deleted = true
+				stack = append(stack, n)
+				continue
+			}
+			horizon = append(horizon, [3]int{qh.faces[f].Indices[j], qh.faces[f].Indices[(j+1)%3], n})
+		}
+	}
+
+	// fan new faces from the horizon to the eye
+	firstNew := len(qh.faces)
+	byStart := make(map[int]int, len(horizon))
+	for _, h := range horizon {
+		nf := qh.newFace(h[0], h[1], eye)
+		byStart[h[0]] = nf
+		qh.faces[nf].Adjacent[0] = h[2]
+		across := &qh.faces[h[2]]
+		for j := 0; j < 3; j++ {
+			if across.Indices[j] == h[1] && across.Indices[(j+1)%3] == h[0] {
+				across.Adjacent[j] = nf
+			}
+		}
+	}
+	for _, h := range horizon {
+		nf := byStart[h[0]]
+		next := byStart[h[1]]
+		qh.faces[nf].Adjacent[1] = next
+		qh.faces[next].Adjacent[2] = nf
+	}
+
+	for _, f := range visible {
+		orphans := qh.faces[f].outside
+		qh.faces[f].outside = nil
+		qh.assign(orphans, firstNew)
+	}
+}
+
+// compact copies the live faces and the vertices they use
+func (result *ConvexHull) compact(qh *quickhull) {
+	vertexMap := make([]int, len(qh.pnts))
+	for i := range vertexMap {
+		vertexMap[i] = -1
+	}
+	faceMap := make([]int, len(qh.faces))
+
+	result.Vertices = result.Vertices[:0]
+	result.Faces = result.Faces[:0]
+	for i := range qh.faces {
+		if qh.faces[i].deleted {
+			continue
+		}
+		faceMap[i] = len(result.Faces)
+		f := qh.faces[i].HullFace
+		for j := 0; j < 3; j++ {
+			v := f.Indices[j]
+			if vertexMap[v] < 0 {
+				vertexMap[v] = len(result.Vertices)
+				result.Vertices = append(result.Vertices, qh.pnts[v])
+			}
+			f.Indices[j] = vertexMap[v]
+		}
+		result.Faces = append(result.Faces, f)
+	}
+	for i := range result.Faces {
+		for j := 0; j < 3; j++ {
+			result.Faces[i].Adjacent[j] = faceMap[result.Faces[i].Adjacent[j]]
+		}
+	}
+}
+
+// Support returns the hull vertex furthest along dir, or the origin for an
+// empty hull
+func (h *ConvexHull) Support(dir *Vector3) Point3 {
+	if len(h.Vertices) == 0 {
+		return Point3{}
+	}
+	best := 0
+	bestDist := h.Vertices[0].Projection(dir)
+	for i := 1; i < len(h.Vertices); i++ {
+		if d := h.Vertices[i].Projection(dir); d > bestDist {
+			bestDist = d
+			best = i
+		}
+	}
+	return h.Vertices[best]
+}
+
+func (h *ConvexHull) ContainsPoint(pnt *Point3) bool {
+	for i := range h.Faces {
+		if h.Faces[i].Plane.Dist(pnt) > g_EPSILON {
+			return false
+		}
+	}
+	return true
+}
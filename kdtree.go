@@ -0,0 +1,258 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"container/heap"
+	"math"
+)
+
+// KDTree is a static k-d tree over a slice of points.  Queries return
+// indices into that slice, which must not be modified while the tree is in
+// use.  The tree is stored implicitly: each range of the index permutation
+// is split at its middle element along the axis of greatest spread.
+type KDTree struct {
+	pnts []Point3
+	idx  []int
+	axes []uint8
+}
+
+const kdLeafSize = 8
+
+func (result *KDTree) Build(pnts []Point3) {
+	result.pnts = pnts
+	if cap(result.idx) < len(pnts) {
+		result.idx = make([]int, len(pnts))
+		result.axes = make([]uint8, len(pnts))
+	}
+	result.idx = result.idx[:len(pnts)]
+	result.axes = result.axes[:len(pnts)]
+	for i := range result.idx {
+		result.idx[i] = i
+	}
+	result.build(0, len(pnts))
+}
+
+func (result *KDTree) build(lo, hi int) {
+	if hi-lo <= kdLeafSize {
+		return
+	}
+
+	var bounds AABB
+	bounds.Min = result.pnts[result.idx[lo]]
+	bounds.Max = bounds.Min
+	for i := lo + 1; i < hi; i++ {
+		bounds.AddPoint(&result.pnts[result.idx[i]])
+	}
+	var extent Vector3
+	extent.P3Sub(&bounds.Max, &bounds.Min)
+	axis := 0
+	if extent[1] > extent[axis] {
+		axis = 1
+	}
+	if extent[2] > extent[axis] {
+		axis = 2
+	}
+
+	mid := (lo + hi) / 2
+	result.selectNth(lo, hi, mid, axis)
+	result.axes[mid] = uint8(axis)
+	result.build(lo, mid)
+	result.build(mid+1, hi)
+}
+
+// selectNth partially sorts idx[lo:hi] so that the element at nth is in
+// its sorted position along axis, with nothing greater before it and
+// nothing less after it
+func (result *KDTree) selectNth(lo, hi, nth, axis int) {
+	idx := result.idx
+	hi--
+	for hi > lo {
+		pivot := result.pnts[idx[(lo+hi)/2]][axis]
+		i, j := lo, hi
+		for i <= j {
+			for result.pnts[idx[i]][axis] < pivot {
+				i++
+			}
+			for result.pnts[idx[j]][axis] > pivot {
+				j--
+			}
+			if i <= j {
+				idx[i], idx[j] = idx[j], idx[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case nth <= j:
+			hi = j
+		case nth >= i:
+			lo = i
+		default:
+			return
+		}
+	}
+}
+
+func (t *KDTree) Len() int {
+	return len(t.idx)
+}
+
+// kdNeighbours is a max heap of the best candidates found so far
+type kdNeighbours struct {
+	items   []int
+	distSqr []float32
+}
+
+func (h *kdNeighbours) Len() int           { return len(h.items) }
+func (h *kdNeighbours) Less(i, j int) bool { return h.distSqr[i] > h.distSqr[j] }
+func (h *kdNeighbours) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.distSqr[i], h.distSqr[j] = h.distSqr[j], h.distSqr[i]
+}
+func (h *kdNeighbours) Push(e interface{}) {}
+func (h *kdNeighbours) Pop() interface{} {
+	last := len(h.items) - 1
+	h.items = h.items[:last]
+	h.distSqr = h.distSqr[:last]
+	return nil
+}
+
+type kdSearch struct {
+	tree  *KDTree
+	pnt   *Point3
+	k     int
+	scale float32 // (1 + eps)^2, shrinking the distance to unvisited subtrees
+	best  kdNeighbours
+}
+
+func (s *kdSearch) worst() float32 {
+	if len(s.best.items) < s.k {
+		return float32(math.MaxFloat32)
+	}
+	return s.best.distSqr[0]
+}
+
+func (s *kdSearch) consider(i int) {
+	distSqr := s.pnt.DistSqr(&s.tree.pnts[i])
+	if len(s.best.items) < s.k {
+		s.best.items = append(s.best.items, i)
+		s.best.distSqr = append(s.best.distSqr, distSqr)
+		heap.Fix(&s.best, len(s.best.items)-1)
+	} else if distSqr < s.best.distSqr[0] {
+		s.best.items[0] = i
+		s.best.distSqr[0] = distSqr
+		heap.Fix(&s.best, 0)
+	}
+}
+
+func (s *kdSearch) search(lo, hi int) {
+	idx := s.tree.idx
+	if hi-lo <= kdLeafSize {
+		for i := lo; i < hi; i++ {
+			s.consider(idx[i])
+		}
+		return
+	}
+
+	mid := (lo + hi) / 2
+	axis := s.tree.axes[mid]
+	s.consider(idx[mid])
+	diff := s.pnt[axis] - s.tree.pnts[idx[mid]][axis]
+	if diff < 0.0 {
+		s.search(lo, mid)
+		if diff*diff*s.scale < s.worst() {
+			s.search(mid+1, hi)
+		}
+	} else {
+		s.search(mid+1, hi)
+		if diff*diff*s.scale < s.worst() {
+			s.search(lo, mid)
+		}
+	}
+}
+
+// Nearest returns the index of the point closest to pnt and its squared
+// distance, or -1 if the tree is empty
+func (t *KDTree) Nearest(pnt *Point3) (int, float32) {
+	return t.NearestApprox(pnt, 0.0)
+}
+
+// NearestApprox returns a point whose distance to pnt is within a factor
+// of (1 + eps) of the nearest
+func (t *KDTree) NearestApprox(pnt *Point3, eps float32) (int, float32) {
+	var items [1]int
+	var distSqr [1]float32
+	s := kdSearch{tree: t, pnt: pnt, k: 1, scale: (1.0 + eps) * (1.0 + eps)}
+	s.best.items = items[:0]
+	s.best.distSqr = distSqr[:0]
+	s.search(0, len(t.idx))
+	if len(s.best.items) == 0 {
+		return -1, 0.0
+	}
+	return s.best.items[0], s.best.distSqr[0]
+}
+
+// KNearest appends to result the indices of the k points closest to pnt,
+// nearest first
+func (t *KDTree) KNearest(pnt *Point3, k int, result []int) []int {
+	return t.KNearestApprox(pnt, k, 0.0, result)
+}
+
+// KNearestApprox is KNearest where the i-th point found is within a factor
+// of (1 + eps) of the distance to the true i-th nearest
+func (t *KDTree) KNearestApprox(pnt *Point3, k int, eps float32, result []int) []int {
+	result = result[:0]
+	if k <= 0 {
+		return result
+	}
+	s := kdSearch{tree: t, pnt: pnt, k: k, scale: (1.0 + eps) * (1.0 + eps)}
+	s.best.items = make([]int, 0, k)
+	s.best.distSqr = make([]float32, 0, k)
+	s.search(0, len(t.idx))
+
+	// popping the max heap yields the furthest first
+	n := len(s.best.items)
+	for i := 0; i < n; i++ {
+		result = append(result, 0)
+	}
+	for i := n - 1; i >= 0; i-- {
+		result[i] = s.best.items[0]
+		heap.Pop(&s.best)
+	}
+	return result
+}
+
+// Radius appends to result the indices of all points within radius of
+// pnt, in no particular order
+func (t *KDTree) Radius(pnt *Point3, radius float32, result []int) []int {
+	result = result[:0]
+	return t.radius(pnt, radius*radius, 0, len(t.idx), result)
+}
+
+func (t *KDTree) radius(pnt *Point3, radiusSqr float32, lo, hi int, result []int) []int {
+	if hi-lo <= kdLeafSize {
+		for i := lo; i < hi; i++ {
+			if pnt.DistSqr(&t.pnts[t.idx[i]]) <= radiusSqr {
+				result = append(result, t.idx[i])
+			}
+		}
+		return result
+	}
+
+	mid := (lo + hi) / 2
+	split := &t.pnts[t.idx[mid]]
+	if pnt.DistSqr(split) <= radiusSqr {
+		result = append(result, t.idx[mid])
+	}
+	diff := pnt[t.axes[mid]] - split[t.axes[mid]]
+	if diff < 0.0 || diff*diff <= radiusSqr {
+		result = t.radius(pnt, radiusSqr, lo, mid, result)
+	}
+	if diff >= 0.0 || diff*diff <= radiusSqr {
+		result = t.radius(pnt, radiusSqr, mid+1, hi, result)
+	}
+	return result
+}
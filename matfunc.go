@@ -0,0 +1,273 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// The matrix functions work on square column major matrices of up to 4x4
+// held in slices, with fixed size scratch arrays so they do not allocate.
+// They read all of their input before writing any of the result, so the
+// result may be the input.
+
+const matFuncMaxIterations = 32
+
+// Padé coefficients of degree six for the exponential
+var expPade = [7]float32{1.0, 1.0 / 2.0, 5.0 / 44.0, 1.0 / 66.0, 1.0 / 792.0, 1.0 / 15840.0, 1.0 / 665280.0}
+
+func matIdentity(result []float32, n int) {
+	for i := range result {
+		result[i] = 0.0
+	}
+	for i := 0; i < n; i++ {
+		result[i*n+i] = 1.0
+	}
+}
+
+// matMul sets result to a * b, and must not share storage with either
+func matMul(result, a, b []float32, n int) {
+	for col := 0; col < n; col++ {
+		for row := 0; row < n; row++ {
+			sum := float32(0.0)
+			for k := 0; k < n; k++ {
+				sum += a[k*n+row] * b[col*n+k]
+			}
+			result[col*n+row] = sum
+		}
+	}
+}
+
+// matNorm1 is the largest absolute column sum
+func matNorm1(a []float32, n int) float32 {
+	result := float32(0.0)
+	for col := 0; col < n; col++ {
+		sum := float32(0.0)
+		for row := 0; row < n; row++ {
+			sum += abs(a[col*n+row])
+		}
+		result = max(result, sum)
+	}
+	return result
+}
+
+// matSolve sets result to inverse(a) * b, returning false if a is
+// singular
+func matSolve(result, a, b []float32, n int) bool {
+	var lu, x [16]float32
+	var perm [4]int
+	copy(lu[:n*n], a)
+	if rank, _ := luFactor(lu[:n*n], n, perm[:n]); rank < n {
+		return false
+	}
+	for col := 0; col < n; col++ {
+		for i := 0; i < n; i++ {
+			x[col*n+i] = b[col*n+perm[i]]
+		}
+		luSolve(lu[:n*n], n, x[col*n:col*n+n])
+	}
+	copy(result, x[:n*n])
+	return true
+}
+
+func matInverse(result, a []float32, n int) bool {
+	var identity [16]float32
+	matIdentity(identity[:n*n], n)
+	return matSolve(result, a, identity[:n*n], n)
+}
+
+// matExp scales a down until its norm is below one half, takes the Padé
+// approximant and squares the result back up
+func matExp(result, a []float32, n int) {
+	m := n * n
+	var scaled, power, tmp, num, den [16]float32
+	squarings := 0
+	scale := float32(1.0)
+	for norm := matNorm1(a, n); norm > 0.5 && squarings < 64; norm *= 0.5 {
+		scale *= 0.5
+		squarings++
+	}
+	for i := 0; i < m; i++ {
+		scaled[i] = a[i] * scale
+	}
+
+	matIdentity(power[:m], n)
+	matIdentity(num[:m], n)
+	matIdentity(den[:m], n)
+	sign := float32(1.0)
+	for k := 1; k < len(expPade); k++ {
+		matMul(tmp[:m], power[:m], scaled[:m], n)
+		power = tmp
+		sign = -sign
+		for i := 0; i < m; i++ {
+			num[i] += expPade[k] * power[i]
+			den[i] += sign * expPade[k] * power[i]
+		}
+	}
+	// the denominator is close to the identity, so never singular
+	matSolve(tmp[:m], den[:m], num[:m], n)
+
+	for i := 0; i < squarings; i++ {
+		matMul(num[:m], tmp[:m], tmp[:m], n)
+		tmp = num
+	}
+	copy(result, tmp[:m])
+}
+
+// matSqrt finds the principal square root by the Denman-Beavers
+// iteration, which fails for matrices with eigenvalues on the closed
+// negative real axis
+func matSqrt(result, a []float32, n int) bool {
+	m := n * n
+	var y, z, yInv, zInv [16]float32
+	copy(y[:m], a)
+	matIdentity(z[:m], n)
+	for iter := 0; iter < matFuncMaxIterations; iter++ {
+		if !matInverse(yInv[:m], y[:m], n) || !matInverse(zInv[:m], z[:m], n) {
+			return false
+		}
+		change := float32(0.0)
+		for i := 0; i < m; i++ {
+			next := 0.5 * (y[i] + zInv[i])
+			change = max(change, abs(next-y[i]))
+			y[i] = next
+			z[i] = 0.5 * (z[i] + yInv[i])
+		}
+		if change <= g_EPSILON*matNorm1(y[:m], n) {
+			copy(result, y[:m])
+			return true
+		}
+	}
+	return false
+}
+
+// matLog takes square roots until a is close to the identity, then sums
+// the series log(a) = 2 atanh((a - I) * inverse(a + I)) and scales back up
+func matLog(result, a []float32, n int) bool {
+	m := n * n
+	var root, below, above, z, zSqr, term, sum [16]float32
+	copy(root[:m], a)
+	roots := 0
+	for {
+		for i := 0; i < m; i++ {
+			below[i] = root[i]
+		}
+		for i := 0; i < n; i++ {
+			below[i*n+i] -= 1.0
+		}
+		if matNorm1(below[:m], n) < 0.25 {
+			break
+		}
+		if roots >= matFuncMaxIterations || !matSqrt(root[:m], root[:m], n) {
+			return false
+		}
+		roots++
+	}
+
+	above = root
+	for i := 0; i < n; i++ {
+		above[i*n+i] += 1.0
+	}
+	if !matSolve(z[:m], above[:m], below[:m], n) {
+		return false
+	}
+	matMul(zSqr[:m], z[:m], z[:m], n)
+	term, sum = z, z
+	for j := 1; j < 8; j++ {
+		matMul(below[:m], term[:m], zSqr[:m], n)
+		term = below
+		inv := 1.0 / float32(2*j+1)
+		for i := 0; i < m; i++ {
+			sum[i] += term[i] * inv
+		}
+	}
+	scale := float32(int(2) << uint(roots))
+	for i := 0; i < m; i++ {
+		result[i] = sum[i] * scale
+	}
+	return true
+}
+
+// Matrix3
+
+// Exp returns the matrix exponential, by scaling and squaring with a
+// degree six Padé approximant.  The exponential of a skew symmetric
+// matrix is a rotation.
+func (result *Matrix3) Exp(mat *Matrix3) {
+	matExp(result[:], mat[:], 3)
+}
+
+func (result *Matrix3) ExpSelf() {
+	result.Exp(result)
+}
+
+// Log returns the principal matrix logarithm, the inverse of Exp, by
+// inverse scaling and squaring.  It returns false, leaving result
+// unchanged, if mat has no real principal logarithm, such as when it is
+// singular, reflects or turns half way round.
+func (result *Matrix3) Log(mat *Matrix3) bool {
+	return matLog(result[:], mat[:], 3)
+}
+
+func (result *Matrix3) LogSelf() bool {
+	return result.Log(result)
+}
+
+// Sqrt returns the principal square root, whose eigenvalues have positive
+// real parts.  It returns false, leaving result unchanged, if there is no
+// such root.
+func (result *Matrix3) Sqrt(mat *Matrix3) bool {
+	return matSqrt(result[:], mat[:], 3)
+}
+
+func (result *Matrix3) SqrtSelf() bool {
+	return result.Sqrt(result)
+}
+
+// Matrix4
+
+func (result *Matrix4) Exp(mat *Matrix4) {
+	matExp(result[:], mat[:], 4)
+}
+
+func (result *Matrix4) ExpSelf() {
+	result.Exp(result)
+}
+
+func (result *Matrix4) Log(mat *Matrix4) bool {
+	return matLog(result[:], mat[:], 4)
+}
+
+func (result *Matrix4) LogSelf() bool {
+	return result.Log(result)
+}
+
+func (result *Matrix4) Sqrt(mat *Matrix4) bool {
+	return matSqrt(result[:], mat[:], 4)
+}
+
+func (result *Matrix4) SqrtSelf() bool {
+	return result.Sqrt(result)
+}
+
+// LogBlend interpolates from tfrm0 at t = 0 to tfrm1 at t = 1 along the
+// logarithm of the transform between them, so rotation, scale, shear and
+// translation all change smoothly together and a pure rotation follows
+// the same path as a slerp.  It returns false if that transform has no
+// real logarithm, as for a reflection or a half turn.
+func (result *Transform3) LogBlend(t float32, tfrm0, tfrm1 *Transform3) bool {
+	var mat0, mat1, rel Matrix4
+	mat0.MakeFromT3(tfrm0)
+	mat1.MakeFromT3(tfrm1)
+	if !matSolve(rel[:], mat0[:], mat1[:], 4) || !rel.LogSelf() {
+		return false
+	}
+	rel.ScalarMulSelf(t)
+	rel.ExpSelf()
+	mat0.MulSelf(&rel)
+
+	var upper Matrix3
+	var trans Vector3
+	mat0.Upper3x3(&upper)
+	mat0.Translation(&trans)
+	result.MakeFromM3V3(&upper, &trans)
+	return true
+}
@@ -34,9 +34,9 @@ func (result *Matrix3) MakeFromScalar(scalar float32) {
 
 func (result *Matrix3) MakeFromQ(unitQuat *Quaternion) {
 	qx := unitQuat[x]
-	qy := unitQuat[x]
-	qz := unitQuat[x]
-	qw := unitQuat[x]
+	qy := unitQuat[y]
+	qz := unitQuat[z]
+	qw := unitQuat[w]
 	qx2 := qx + qx
 	qy2 := qy + qy
 	qz2 := qz + qz
@@ -189,8 +189,8 @@ func (m *Matrix3) InverseSelf() {
 func (m *Matrix3) Determinant() float32 {
 	var col0, col1, col2, tmp Vector3
 	m.Col(&col0, 0)
-	m.Col(&col1, 0)
-	m.Col(&col2, 0)
+	m.Col(&col1, 1)
+	m.Col(&col2, 2)
 
 	tmp.Cross(&col0, &col1)
 
@@ -0,0 +1,823 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"testing"
+)
+
+func TestMatrix3MakeFromQ(t *testing.T) {
+	// a quarter turn about z takes x to y
+	var quat Quaternion
+	var mat Matrix3
+	quat.MakeRotationZ(0.5 * 3.14159265)
+	mat.MakeFromQ(&quat)
+	want := Matrix3{0, 1, 0, -1, 0, 0, 0, 0, 1}
+	for i := range mat {
+		if !nearlyEqual(mat[i], want[i]) {
+			t.Fatal("matrix from quaternion", mat)
+		}
+	}
+}
+
+func TestMatrix3Determinant(t *testing.T) {
+	mat := Matrix3{2, 0, 0, 1, 3, 0, 4, 5, 7}
+	if det := mat.Determinant(); !nearlyEqual(det, 42) {
+		t.Error("determinant", det)
+	}
+	// swapping two columns flips the sign
+	mat = Matrix3{1, 3, 0, 2, 0, 0, 4, 5, 7}
+	if det := mat.Determinant(); !nearlyEqual(det, -42) {
+		t.Error("determinant of swapped columns", det)
+	}
+}
+
+func m3NearlyEqual(mat0, mat1 *Matrix3) bool {
+	for i := range mat0 {
+		if !nearlyEqual(mat0[i], mat1[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func v4NearlyEqual(vec0, vec1 *Vector4) bool {
+	for i := range vec0 {
+		if !nearlyEqual(vec0[i], vec1[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// m3Rotation returns a rotation about an awkward axis
+func m3Rotation(radians float32) Matrix3 {
+	var rot Matrix3
+	axis := Vector3{1, 2, -2}
+	axis.NormalizeSelf()
+	rot.MakeRotationAxis(radians, &axis)
+	return rot
+}
+
+// m3FromEigen returns vectors * diag(values) * transpose(vectors)
+func m3FromEigen(values *Vector3, vectors *Matrix3) Matrix3 {
+	var scaled, transposed, result Matrix3
+	scaled.AppendScale(vectors, values)
+	transposed.Transpose(vectors)
+	result.Mul(&scaled, &transposed)
+	return result
+}
+
+func checkRotation(t *testing.T, name string, rot *Matrix3) {
+	var transposed, product, identity Matrix3
+	transposed.Transpose(rot)
+	product.Mul(&transposed, rot)
+	identity.MakeIdentity()
+	if !m3NearlyEqual(&product, &identity) || !nearlyEqual(rot.Determinant(), 1) {
+		t.Error(name, "not a rotation", *rot, rot.Determinant())
+	}
+}
+
+func TestSymmetricEigen(t *testing.T) {
+	rot := m3Rotation(0.7)
+	want := Vector3{-5, 3, 1}
+	mat := m3FromEigen(&want, &rot)
+
+	var values Vector3
+	var vectors Matrix3
+	mat.SymmetricEigen(&values, &vectors)
+	if !v3NearlyEqual(&values, &want) {
+		t.Error("eigenvalues", values)
+	}
+	checkRotation(t, "eigenvectors", &vectors)
+	if back := m3FromEigen(&values, &vectors); !m3NearlyEqual(&back, &mat) {
+		t.Error("eigen reconstruction", back, mat)
+	}
+
+	// repeated eigenvalues still give an orthonormal frame
+	want = Vector3{2, 2, -1}
+	mat = m3FromEigen(&want, &rot)
+	mat.SymmetricEigen(&values, &vectors)
+	if !v3NearlyEqual(&values, &want) {
+		t.Error("repeated eigenvalues", values)
+	}
+	checkRotation(t, "repeated eigenvectors", &vectors)
+
+	var zero Matrix3
+	zero.SymmetricEigen(&values, &vectors)
+	if values != (Vector3{}) {
+		t.Error("zero eigenvalues", values)
+	}
+	checkRotation(t, "zero eigenvectors", &vectors)
+
+	// diagonalizing gives back the rotation of the principal axes
+	want = Vector3{4, 2, 1}
+	mat = m3FromEigen(&want, &rot)
+	var quat Quaternion
+	mat.Diagonalize(&values, &quat)
+	var fromQuat Matrix3
+	fromQuat.MakeFromQ(&quat)
+	if back := m3FromEigen(&values, &fromQuat); !m3NearlyEqual(&back, &mat) {
+		t.Error("diagonalize", back, mat)
+	}
+}
+
+func TestSVD(t *testing.T) {
+	rot0 := m3Rotation(0.7)
+	rot1 := m3Rotation(-2.1)
+	rot1.MulSelf(&rot0)
+	var mat, transposed Matrix3
+	scale := Vector3{-3, 2, 0.5}
+	mat.AppendScale(&rot0, &scale)
+	transposed.Transpose(&rot1)
+	mat.MulSelf(&transposed)
+
+	var u, v Matrix3
+	var sigma Vector3
+	mat.SVD(&u, &sigma, &v)
+	checkRotation(t, "svd u", &u)
+	checkRotation(t, "svd v", &v)
+	if !nearlyEqual(sigma[x], 3) || !nearlyEqual(sigma[y], 2) || !nearlyEqual(sigma[z], -0.5) {
+		t.Error("singular values", sigma)
+	}
+	var back, scaled Matrix3
+	scaled.AppendScale(&u, &sigma)
+	transposed.Transpose(&v)
+	back.Mul(&scaled, &transposed)
+	if !m3NearlyEqual(&back, &mat) {
+		t.Error("svd reconstruction", back, mat)
+	}
+
+	// small singular values keep their relative accuracy, which squaring
+	// them through mT * m would lose
+	var near Matrix3
+	near.AppendScale(&rot0, &Vector3{1, 1e-3, 5e-4})
+	transposed.Transpose(&rot1)
+	near.MulSelf(&transposed)
+	near.SVD(&u, &sigma, &v)
+	if !nearlyEqual(sigma[x], 1) || abs(sigma[y]/1e-3-1) > 1e-2 || abs(sigma[z]/5e-4-1) > 1e-2 {
+		t.Error("ill conditioned singular values", sigma)
+	}
+
+	// rank deficient matrices still give rotations
+	var flat Matrix3
+	flat.V3Outer(&Vector3{1, 2, 3}, &Vector3{0, 1, -1})
+	flat.SVD(&u, &sigma, &v)
+	checkRotation(t, "rank one u", &u)
+	checkRotation(t, "rank one v", &v)
+	if !nearlyEqual(sigma[y], 0) || !nearlyEqual(sigma[z], 0) {
+		t.Error("rank one singular values", sigma)
+	}
+
+	// a rotation with stretch splits back into its parts
+	var stretch, polarRot, polarStretch Matrix3
+	stretch = m3FromEigen(&Vector3{2, 1.5, 0.8}, &rot1)
+	mat.Mul(&rot0, &stretch)
+	mat.Polar(&polarRot, &polarStretch)
+	if !m3NearlyEqual(&polarRot, &rot0) || !m3NearlyEqual(&polarStretch, &stretch) {
+		t.Error("polar", polarRot, polarStretch)
+	}
+	var quat Quaternion
+	mat.PolarQ(&quat, nil)
+	back.MakeFromQ(&quat)
+	if !m3NearlyEqual(&back, &rot0) {
+		t.Error("polar quaternion", back)
+	}
+
+	// drifted rotations are pulled back to the nearest rotation
+	mat = rot0
+	mat[1] += 0.01
+	mat[5] -= 0.02
+	mat.NearestRotationSelf()
+	checkRotation(t, "nearest rotation", &mat)
+	var tfrm Transform3
+	tfrm.MakeFromM3V3(&stretch, &Vector3{1, 2, 3})
+	tfrm.NearestRotationSelf()
+	var upper Matrix3
+	var trans Vector3
+	tfrm.Upper3x3(&upper)
+	tfrm.Translation(&trans)
+	checkRotation(t, "transform nearest rotation", &upper)
+	if !m3NearlyEqual(&upper, &Matrix3{1, 0, 0, 0, 1, 0, 0, 0, 1}) || trans != (Vector3{1, 2, 3}) {
+		t.Error("transform nearest rotation", tfrm)
+	}
+}
+
+func TestOrthonormalize(t *testing.T) {
+	rot := m3Rotation(0.7)
+	sheared := rot
+	sheared[3] += 0.05
+	sheared[7] -= 0.03
+	sheared.ScalarMulSelf(1.1)
+	if !rot.IsOrthonormal(1e-5) || sheared.IsOrthonormal(1e-3) {
+		t.Error("is orthonormal", rot.IsOrthonormal(1e-5), sheared.IsOrthonormal(1e-3))
+	}
+
+	for axis := 0; axis < 3; axis++ {
+		var fixed Matrix3
+		fixed.Orthonormalize(&sheared, axis)
+		checkRotation(t, "orthonormalize", &fixed)
+		var primary, want Vector3
+		fixed.Col(&primary, axis)
+		sheared.Col(&want, axis)
+		want.NormalizeSelf()
+		if !v3NearlyEqual(&primary, &want) {
+			t.Error("orthonormalize moved primary axis", axis, primary, want)
+		}
+	}
+
+	// a column collapsed onto the primary axis is rebuilt
+	var collapsed Matrix3
+	collapsed.MakeFromCols(&Vector3{0, 0, 2}, &Vector3{0, 0, 1}, &Vector3{})
+	collapsed.OrthonormalizeSelf(0)
+	checkRotation(t, "collapsed orthonormalize", &collapsed)
+
+	var tfrm Transform3
+	tfrm.MakeFromM3V3(&sheared, &Vector3{1, 2, 3})
+	if tfrm.IsOrthonormal(1e-3) {
+		t.Error("transform is orthonormal")
+	}
+	tfrm.OrthonormalizeSelf(2)
+	var trans Vector3
+	tfrm.Translation(&trans)
+	if !tfrm.IsOrthonormal(1e-5) || trans != (Vector3{1, 2, 3}) {
+		t.Error("transform orthonormalize", tfrm)
+	}
+
+	var mat Matrix4
+	mat.MakeIdentity()
+	mat.SetUpper3x3(&sheared)
+	mat[15] = 2
+	mat.OrthonormalizeSelf(1)
+	if !mat.IsOrthonormal(1e-5) || mat[15] != 2 {
+		t.Error("matrix4 orthonormalize", mat)
+	}
+}
+
+func TestFactorisations(t *testing.T) {
+	mat := Matrix3{2, -1, 0, 1, 3, 2, 4, 0, 1}
+	want := Vector3{1, -2, 0.5}
+	var b, sol Vector3
+	b.MulM3(&want, &mat)
+
+	var lu LU3
+	lu.MakeFromM3(&mat)
+	if lu.Rank() != 3 || !lu.Solve(&sol, &b) || !v3NearlyEqual(&sol, &want) {
+		t.Error("lu3 solve", lu.Rank(), sol)
+	}
+	if !nearlyEqual(lu.Determinant(), mat.Determinant()) {
+		t.Error("lu3 determinant", lu.Determinant(), mat.Determinant())
+	}
+
+	var qr QR3
+	qr.MakeFromM3(&mat)
+	if qr.Rank() != 3 || !qr.Solve(&sol, &b) || !v3NearlyEqual(&sol, &want) {
+		t.Error("qr3 solve", qr.Rank(), sol)
+	}
+	var q, r, qTimesR, permuted Matrix3
+	qr.Q(&q)
+	qr.R(&r)
+	if !q.IsOrthonormal(1e-5) {
+		t.Error("qr3 q", q)
+	}
+	qTimesR.Mul(&q, &r)
+	piv := qr.Pivots()
+	for i := 0; i < 3; i++ {
+		var col Vector3
+		mat.Col(&col, piv[i])
+		permuted.SetCol(i, &col)
+	}
+	if !m3NearlyEqual(&qTimesR, &permuted) {
+		t.Error("qr3 reconstruction", qTimesR, permuted)
+	}
+
+	// singular matrices are detected, including ones with a zero pivot
+	// that partial pivoting cannot swap away
+	rankTwo := Matrix3{1, 2, 3, 2, 4, 6, 0, 1, 1}
+	rankOne := Matrix3{0, 0, 0, 1, 0, 0, 0, 0, 0}
+	for _, test := range []struct {
+		mat  Matrix3
+		rank int
+	}{{rankTwo, 2}, {rankOne, 1}, {Matrix3{}, 0}} {
+		lu.MakeFromM3(&test.mat)
+		qr.MakeFromM3(&test.mat)
+		if lu.Rank() != test.rank || qr.Rank() != test.rank || lu.Solve(&sol, &b) || lu.Determinant() != 0 {
+			t.Error("rank", test.mat, lu.Rank(), qr.Rank())
+		}
+	}
+
+	// rank deficient least squares still fits what it can
+	qr.MakeFromM3(&rankTwo)
+	var fit Vector3
+	b = Vector3{1, 2, 3}
+	qr.Solve(&sol, &b)
+	fit.MulM3(&sol, &rankTwo)
+	if !v3NearlyEqual(&fit, &b) {
+		t.Error("qr3 rank deficient solve", sol, fit)
+	}
+
+	var spd, lower Matrix3
+	spd.V3Outer(&Vector3{1, 2, 0}, &Vector3{1, 2, 0})
+	spd.AddToSelf(&Matrix3{3, 0, 0, 0, 2, 0, 0, 0, 1})
+	b.MulM3(&want, &spd)
+	var chol Cholesky3
+	if !chol.MakeFromM3(&spd) {
+		t.Fatal("cholesky3 rejected positive definite matrix")
+	}
+	chol.Solve(&sol, &b)
+	if !v3NearlyEqual(&sol, &want) {
+		t.Error("cholesky3 solve", sol)
+	}
+	chol.L(&lower)
+	var lowerT, product Matrix3
+	lowerT.Transpose(&lower)
+	product.Mul(&lower, &lowerT)
+	if !m3NearlyEqual(&product, &spd) {
+		t.Error("cholesky3 factor", product, spd)
+	}
+	indefinite := Matrix3{1, 0, 0, 0, -1, 0, 0, 0, 1}
+	if chol.MakeFromM3(&indefinite) {
+		t.Error("cholesky3 accepted indefinite matrix")
+	}
+
+	var mat4 Matrix4
+	mat4.MakeFromT3(&Transform3{2, 1, 0, -1, 3, 1, 0, 2, 4, 1, 2, 3})
+	mat4[m4col0+w] = 0.5
+	want4 := Vector4{1, 2, -1, 0.5}
+	var b4, sol4 Vector4
+	b4.MulM4(&want4, &mat4)
+	var lu4 LU4
+	lu4.MakeFromM4(&mat4)
+	if lu4.Rank() != 4 || !lu4.Solve(&sol4, &b4) || !v4NearlyEqual(&sol4, &want4) {
+		t.Error("lu4 solve", sol4)
+	}
+	var qr4 QR4
+	qr4.MakeFromM4(&mat4)
+	if qr4.Rank() != 4 || !qr4.Solve(&sol4, &b4) || !v4NearlyEqual(&sol4, &want4) {
+		t.Error("qr4 solve", sol4)
+	}
+	var spd4, mat4T Matrix4
+	mat4T.Transpose(&mat4)
+	spd4.Mul(&mat4T, &mat4)
+	b4.MulM4(&want4, &spd4)
+	var chol4 Cholesky4
+	if !chol4.MakeFromM4(&spd4) {
+		t.Fatal("cholesky4 rejected positive definite matrix")
+	}
+	chol4.Solve(&sol4, &b4)
+	if !v4NearlyEqual(&sol4, &want4) {
+		t.Error("cholesky4 solve", sol4)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		lu4.MakeFromM4(&mat4)
+		lu4.Solve(&sol4, &b4)
+		qr4.MakeFromM4(&mat4)
+		qr4.Solve(&sol4, &b4)
+		chol4.MakeFromM4(&spd4)
+		chol4.Solve(&sol4, &b4)
+	})
+	if allocs != 0 {
+		t.Error("factorisations allocated", allocs)
+	}
+}
+
+func TestPseudoInverse(t *testing.T) {
+	mat := Matrix3{2, -1, 0, 1, 3, 2, 4, 0, 1}
+	var pinv, product, identity Matrix3
+	identity.MakeIdentity()
+	pinv.PseudoInverse(&mat, 1e-5)
+	product.Mul(&mat, &pinv)
+	if !m3NearlyEqual(&product, &identity) {
+		t.Error("pseudo-inverse of invertible matrix", product)
+	}
+
+	// the Penrose conditions hold for a singular matrix
+	singular := Matrix3{1, 2, 3, 2, 4, 6, 0, 1, 1}
+	var back Matrix3
+	pinv = singular
+	pinv.PseudoInverseSelf(1e-5)
+	product.Mul(&singular, &pinv)
+	back.Mul(&product, &singular)
+	if !m3NearlyEqual(&back, &singular) {
+		t.Error("pseudo-inverse a * a+ * a", back)
+	}
+	product.Mul(&pinv, &singular)
+	back.Mul(&product, &pinv)
+	if !m3NearlyEqual(&back, &pinv) {
+		t.Error("pseudo-inverse a+ * a * a+", back, pinv)
+	}
+
+	var mat4, pinv4, product4, identity4 Matrix4
+	mat4.MakeFromT3(&Transform3{2, 1, 0, -1, 3, 1, 0, 2, 4, 1, 2, 3})
+	identity4.MakeIdentity()
+	pinv4.PseudoInverse(&mat4, 1e-5)
+	product4.Mul(&pinv4, &mat4)
+	for i := range product4 {
+		if !nearlyEqual(product4[i], identity4[i]) {
+			t.Fatal("matrix4 pseudo-inverse", product4)
+		}
+	}
+	// dropping the last row leaves the least squares solution
+	mat4[m4col3+w] = 0
+	pinv4.PseudoInverse(&mat4, 1e-5)
+	var sol, fit Vector4
+	b := Vector4{1, 2, 3, 4}
+	sol.MulM4(&b, &pinv4)
+	fit.MulM4(&sol, &mat4)
+	if !nearlyEqual(fit[x], 1) || !nearlyEqual(fit[y], 2) || !nearlyEqual(fit[z], 3) {
+		t.Error("matrix4 least squares", fit)
+	}
+
+	// small singular values are still inverted accurately
+	rot0 := m3Rotation(0.7)
+	rot1 := m3Rotation(-2.1)
+	var near, transposed Matrix3
+	near.AppendScale(&rot0, &Vector3{1, 1e-3, 5e-4})
+	transposed.Transpose(&rot1)
+	near.MulSelf(&transposed)
+	mat4.MakeFromM3V3(&near, &Vector3{})
+	pinv4.PseudoInverse(&mat4, 1e-5)
+	product4.Mul(&pinv4, &mat4)
+	for i := range product4 {
+		if abs(product4[i]-identity4[i]) > 1e-2 {
+			t.Fatal("ill conditioned matrix4 pseudo-inverse", product4)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	var plane Plane
+	var normal Vector3
+	pnts := []Point3{{0, 0, 1}, {1, 0, 1.01}, {0, 1, 0.99}, {1, 1, 1}, {0.5, 0.5, 1}}
+	if !plane.MakeFit(pnts) {
+		t.Fatal("plane fit failed")
+	}
+	plane.Normal(&normal)
+	if abs(normal[z]) < 0.999 || abs(plane.Dist(&Point3{0.5, 0.5, 1})) > 0.01 {
+		t.Error("plane fit", plane)
+	}
+	if plane.MakeFit([]Point3{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}}) {
+		t.Error("plane fit through collinear points")
+	}
+
+	var line Ray
+	if !line.MakeFit([]Point3{{1, 1, 0}, {2, 2, 0.01}, {3, 3, 0}, {4, 4, -0.01}}) {
+		t.Fatal("line fit failed")
+	}
+	if !p3NearlyEqual(&line.Origin, &Point3{2.5, 2.5, 0}) || abs(line.Direction[x]-line.Direction[y]) > 1e-3 ||
+		!nearlyEqual(abs(line.Direction[x]), 1/sqrt(2)) {
+		t.Error("line fit", line)
+	}
+
+	var sphere Sphere
+	center := Point3{1, -2, 3}
+	pnts = pnts[:0]
+	for i := 0; i < 20; i++ {
+		dir := Vector3{cos(float32(i)), sin(float32(i) * 1.3), cos(float32(i) * 0.7)}
+		dir.NormalizeSelf()
+		dir.ScalarMulSelf(2.5)
+		var pnt Point3
+		pnt.AddV3(&center, &dir)
+		pnts = append(pnts, pnt)
+	}
+	if !sphere.MakeFit(pnts) || !p3NearlyEqual(&sphere.Center, &center) || !nearlyEqual(sphere.Radius, 2.5) {
+		t.Error("sphere fit", sphere)
+	}
+	circle := []Point3{{3, 0, 1}, {0, 3, 1}, {-3, 0, 1}, {0, -3, 1}, {2.1213203, 2.1213203, 1}}
+	if !sphere.MakeFit(circle) || !p3NearlyEqual(&sphere.Center, &Point3{0, 0, 1}) || !nearlyEqual(sphere.Radius, 3) {
+		t.Error("circle sphere fit", sphere)
+	}
+
+	var want, fitted Transform3
+	rot := m3Rotation(1.1)
+	want.MakeFromM3V3(&rot, &Vector3{3, -1, 2})
+	from := []Point3{{0, 0, 0}, {1, 0, 0}, {0, 2, 0}, {0, 0, 3}, {1, 1, 1}}
+	to := make([]Point3, len(from))
+	for i := range from {
+		to[i].MulT3(&want, &from[i])
+	}
+	if !fitted.MakeRigidFit(from, to) || !t3NearlyEqual(&fitted, &want) {
+		t.Error("rigid fit", fitted, want)
+	}
+
+	scaled := rot
+	scaled.ScalarMulSelf(1.5)
+	want.SetUpper3x3(&scaled)
+	for i := range from {
+		to[i].MulT3(&want, &from[i])
+	}
+	if !fitted.MakeSimilarityFit(from, to) || !t3NearlyEqual(&fitted, &want) {
+		t.Error("similarity fit", fitted, want)
+	}
+	if fitted.MakeRigidFit(from, to[:2]) {
+		t.Error("rigid fit of mismatched sets")
+	}
+}
+
+func t3NearlyEqual(tfrm0, tfrm1 *Transform3) bool {
+	for i := range tfrm0 {
+		if !nearlyEqual(tfrm0[i], tfrm1[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMatrixN(t *testing.T) {
+	vec0 := VectorN{1, -2, 3, 4, 5}
+	vec1 := VectorN{2, 0, 1, -1, 0.5}
+	var sum VectorN
+	sum.Add(&vec0, &vec1)
+	sum.ScalarMulSelf(2)
+	sum.SubFromSelf(&vec1)
+	for i := range sum {
+		if !nearlyEqual(sum[i], 2*vec0[i]+vec1[i]) {
+			t.Fatal("vectorn arithmetic", sum)
+		}
+	}
+	if !nearlyEqual(vec0.Dot(&vec1), 3.5) || !nearlyEqual(vec0.Norm1(), 15) || vec0.NormInf() != 5 ||
+		!nearlyEqual(vec0.Length(), sqrt(55)) {
+		t.Error("vectorn norms", vec0.Dot(&vec1), vec0.Norm1(), vec0.NormInf(), vec0.Length())
+	}
+
+	// products agree with the fixed size types
+	mat3 := Matrix3{2, -1, 0, 1, 3, 2, 4, 0, 1}
+	other3 := m3Rotation(0.4)
+	var matN, otherN, productN MatrixN
+	matN.MakeFromM3(&mat3)
+	otherN.MakeFromM3(&other3)
+	productN.Mul(&matN, &otherN)
+	var product3, fromN Matrix3
+	product3.Mul(&mat3, &other3)
+	productN.M3(&fromN, 0, 0)
+	if !m3NearlyEqual(&fromN, &product3) {
+		t.Error("matrixn mul", fromN, product3)
+	}
+	productN.Copy(&matN)
+	productN.MulSelf(&otherN)
+	productN.M3(&fromN, 0, 0)
+	if !m3NearlyEqual(&fromN, &product3) {
+		t.Error("matrixn mul self", fromN, product3)
+	}
+	productN.TransposeSelf()
+	productN.M3(&fromN, 0, 0)
+	product3.TransposeSelf()
+	if !m3NearlyEqual(&fromN, &product3) {
+		t.Error("matrixn transpose", fromN, product3)
+	}
+
+	vec3 := Vector3{1, 2, 3}
+	var vecN VectorN
+	var want Vector3
+	vecN.MakeFromV3(&vec3)
+	vecN.MulMN(&vecN, &matN)
+	vecN.V3(&vec3, 0)
+	want.MulM3(&Vector3{1, 2, 3}, &mat3)
+	if !v3NearlyEqual(&vec3, &want) {
+		t.Error("matrixn vector product", vec3, want)
+	}
+
+	// a non-square block matrix
+	var tall, tallT, normal MatrixN
+	tall.MakeZero(7, 3)
+	tall.SetM3(0, 0, &mat3)
+	tall.SetM3(0, 4, &other3)
+	tall.SetElem(1, 3, 5)
+	tallT.Transpose(&tall)
+	if tallT.Rows != 3 || tallT.Cols != 7 || tallT.Elem(3, 1) != 5 || tall.Elem(1, 3) != 5 {
+		t.Error("matrixn transpose shape", tallT)
+	}
+	if !nearlyEqual(tall.NormInf(), 7) || !nearlyEqual(tall.Norm1(), tallT.NormInf()) {
+		t.Error("matrixn norms", tall.Norm1(), tall.NormInf())
+	}
+	normal.Mul(&tallT, &tall)
+	if normal.Rows != 3 || normal.Cols != 3 || !nearlyEqual(normal.Elem(1, 1), 1+9+4+25+1) {
+		t.Error("matrixn normal matrix", normal)
+	}
+
+	// solves on a larger system
+	var big MatrixN
+	n := 6
+	big.MakeIdentity(n)
+	big.ScalarMulSelf(4)
+	for i := 0; i < n-1; i++ {
+		big.SetElem(i, i+1, -1)
+		big.SetElem(i+1, i, -1)
+	}
+	wantN := VectorN{1, 2, 3, -1, -2, 0.5}
+	var b, sol VectorN
+	b.MulMN(&wantN, &big)
+
+	var lu LUN
+	lu.MakeFromMN(&big)
+	if lu.Rank() != n || !lu.Solve(&sol, &b) {
+		t.Fatal("lun solve failed", lu.Rank())
+	}
+	var diff VectorN
+	diff.Sub(&sol, &wantN)
+	if diff.NormInf() > testTolerance {
+		t.Error("lun solve", sol)
+	}
+	var chol CholeskyN
+	if !chol.MakeFromMN(&big) {
+		t.Fatal("choleskyn rejected positive definite matrix")
+	}
+	chol.Solve(&b, &b)
+	diff.Sub(&b, &wantN)
+	if diff.NormInf() > testTolerance {
+		t.Error("choleskyn solve", b)
+	}
+
+	var mat4 Matrix4
+	mat4.MakeFromT3(&Transform3{2, 1, 0, -1, 3, 1, 0, 2, 4, 1, 2, 3})
+	var lu4 LU4
+	lu4.MakeFromM4(&mat4)
+	matN.MakeFromM4(&mat4)
+	lu.MakeFromMN(&matN)
+	if !nearlyEqual(lu.Determinant(), lu4.Determinant()) {
+		t.Error("lun determinant", lu.Determinant(), lu4.Determinant())
+	}
+	matN.SetElem(3, 3, 0)
+	lu.MakeFromMN(&matN)
+	if lu.Rank() != 3 || lu.Solve(&sol, &VectorN{1, 2, 3, 4}) {
+		t.Error("lun rank", lu.Rank())
+	}
+}
+
+func TestSparse(t *testing.T) {
+	// a chain of springs between 3d points, coupled by 3x3 blocks, plus
+	// a mass term to keep it positive definite
+	const nodes = 40
+	n := nodes * 3
+	var builder SparseBuilder
+	builder.Reset(n, n)
+	var mass, stiff, negStiff Matrix3
+	mass.MakeIdentity()
+	stiff.V3Outer(&Vector3{1, 0.5, 0.2}, &Vector3{1, 0.5, 0.2})
+	stiff.AddToSelf(&mass)
+	negStiff.Neg(&stiff)
+	for i := 0; i < nodes; i++ {
+		builder.AddM3(i*3, i*3, &mass)
+		if i+1 < nodes {
+			builder.AddM3(i*3, i*3, &stiff)
+			builder.AddM3((i+1)*3, (i+1)*3, &stiff)
+			builder.AddM3((i+1)*3, i*3, &negStiff)
+			builder.AddM3(i*3, (i+1)*3, &negStiff)
+		}
+	}
+	var mat SparseMatrix
+	builder.Build(&mat)
+	if mat.NonZeros() != 9*(nodes+2*(nodes-1)) {
+		t.Error("sparse non-zeros", mat.NonZeros())
+	}
+	var block, want Matrix3
+	mat.M3(&block, 3, 3)
+	want.ScalarMul(&stiff, 2)
+	want.AddToSelf(&mass)
+	if !m3NearlyEqual(&block, &want) || mat.Elem(9, 0) != 0 {
+		t.Error("sparse block", block)
+	}
+
+	var dense MatrixN
+	dense.MakeZero(n, n)
+	for row := 0; row < n; row++ {
+		for i := mat.RowStart[row]; i < mat.RowStart[row+1]; i++ {
+			dense.SetElem(mat.ColIndex[i], row, mat.Values[i])
+		}
+	}
+	x := make(VectorN, n)
+	for i := range x {
+		x[i] = sin(float32(i))
+	}
+	var b, denseB VectorN
+	b.MulSparse(&x, &mat)
+	denseB.MulMN(&x, &dense)
+	var diff VectorN
+	diff.Sub(&b, &denseB)
+	if diff.NormInf() > testTolerance {
+		t.Error("sparse product", diff.NormInf())
+	}
+
+	var jacobi JacobiPreconditioner
+	var ichol IncompleteCholesky
+	jacobi.MakeFromSparse(&mat)
+	if !ichol.MakeFromSparse(&mat) {
+		t.Fatal("incomplete cholesky failed")
+	}
+	cg := ConjugateGradient{MaxIterations: 2 * n, Tolerance: 1e-6}
+	iterations := make([]int, 0, 3)
+	for _, precond := range []Preconditioner{nil, &jacobi, &ichol} {
+		var sol VectorN
+		iters, ok := cg.Solve(&sol, &mat, &b, precond)
+		diff.Sub(&sol, &x)
+		if !ok || diff.NormInf() > 1e-3 {
+			t.Error("conjugate gradient", precond, iters, diff.NormInf())
+		}
+		iterations = append(iterations, iters)
+	}
+	// a chain is tridiagonal in blocks, so incomplete Cholesky is nearly
+	// exact
+	if iterations[2] > iterations[1] || iterations[2] > 5 {
+		t.Error("preconditioned iterations", iterations)
+	}
+
+	// a solve that starts at the answer stops at once
+	if iters, ok := cg.Solve(&x, &mat, &b, &jacobi); iters != 0 || !ok {
+		t.Error("warm started solve", iters, ok)
+	}
+}
+
+func TestMatrixFunctions(t *testing.T) {
+	// the exponential of a cross product matrix is a rotation
+	axis := Vector3{1, 2, -2}
+	axis.NormalizeSelf()
+	var skew, rot, want Matrix3
+	var scaledAxis Vector3
+	scaledAxis.ScalarMul(&axis, 0.7)
+	skew.V3CrossMatrix(&scaledAxis)
+	rot.Exp(&skew)
+	want = m3Rotation(0.7)
+	if !m3NearlyEqual(&rot, &want) {
+		t.Error("exp rotation", rot, want)
+	}
+	if !rot.LogSelf() || !m3NearlyEqual(&rot, &skew) {
+		t.Error("log rotation", rot, skew)
+	}
+
+	// exp and log are inverse for a large general matrix
+	mat := Matrix3{0.3, -1.2, 0.5, 2, 0.1, -0.4, 0.7, 1.5, -0.2}
+	var expMat, back Matrix3
+	expMat.Exp(&mat)
+	if !back.Log(&expMat) || !m3NearlyEqual(&back, &mat) {
+		t.Error("log exp", back, mat)
+	}
+
+	spd := m3FromEigen(&Vector3{9, 4, 0.25}, &want)
+	wantRoot := m3FromEigen(&Vector3{3, 2, 0.5}, &want)
+	var root, square Matrix3
+	if !root.Sqrt(&spd) {
+		t.Fatal("sqrt failed")
+	}
+	square.Mul(&root, &root)
+	if !m3NearlyEqual(&square, &spd) || !m3NearlyEqual(&root, &wantRoot) {
+		t.Error("sqrt", root)
+	}
+
+	reflect := Matrix3{-1, 0, 0, 0, 1, 0, 0, 0, 1}
+	back = mat
+	if back.Log(&reflect) || back.Sqrt(&reflect) || back != mat {
+		t.Error("log of a reflection", back)
+	}
+
+	// the exponential of a generator with translation
+	var gen, mat4 Matrix4
+	gen[m4col3+x] = 2
+	gen[m4col3+z] = -1
+	mat4.Exp(&gen)
+	var trans Vector3
+	mat4.Translation(&trans)
+	if !v3NearlyEqual(&trans, &Vector3{2, 0, -1}) || !nearlyEqual(mat4[m4col3+w], 1) {
+		t.Error("matrix4 exp", mat4)
+	}
+	if !mat4.LogSelf() {
+		t.Fatal("matrix4 log failed")
+	}
+	for i := range mat4 {
+		if !nearlyEqual(mat4[i], gen[i]) {
+			t.Fatal("matrix4 log", mat4)
+		}
+	}
+
+	var tfrm0, tfrm1, blend, wantT Transform3
+	tfrm0.MakeTranslation(&Vector3{1, 2, 3})
+	rot = m3Rotation(1.2)
+	scaled := rot
+	scaled.ScalarMulSelf(4)
+	tfrm1.MakeFromM3V3(&scaled, &Vector3{-3, 0, 5})
+	for _, end := range []struct {
+		t    float32
+		want *Transform3
+	}{{0, &tfrm0}, {1, &tfrm1}} {
+		if !blend.LogBlend(end.t, &tfrm0, &tfrm1) || !t3NearlyEqual(&blend, end.want) {
+			t.Error("log blend end", end.t, blend)
+		}
+	}
+	if !blend.LogBlend(0.5, &tfrm0, &tfrm1) {
+		t.Fatal("log blend failed")
+	}
+	var upper Matrix3
+	blend.Upper3x3(&upper)
+	want = m3Rotation(0.6)
+	want.ScalarMulSelf(2)
+	if !m3NearlyEqual(&upper, &want) {
+		t.Error("log blend halfway", upper, want)
+	}
+	half := tfrm1
+	half.SetTranslation(&Vector3{})
+	if !wantT.LogBlend(0.5, &half, &half) || !t3NearlyEqual(&wantT, &half) {
+		t.Error("log blend of equal transforms", wantT)
+	}
+}
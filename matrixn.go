@@ -0,0 +1,468 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// VectorN is a vector whose length is chosen at run time.  Results are
+// written into the receiver, which grows when it is too short and reuses
+// its storage otherwise.
+type VectorN []float32
+
+// MatrixN is a dense matrix whose size is chosen at run time.  It is
+// stored in column major order like the fixed size matrices, so element
+// (col, row) is Data[col*Rows+row].
+type MatrixN struct {
+	Rows, Cols int
+	Data       []float32
+}
+
+// LUN is the LU factorisation of a square MatrixN with partial pivoting
+type LUN struct {
+	lu   MatrixN
+	perm []int
+	sign float32
+	rank int
+	tmp  VectorN
+}
+
+// CholeskyN is the factorisation L * transpose(L) of a symmetric positive
+// definite MatrixN
+type CholeskyN struct {
+	l MatrixN
+}
+
+func checkLen(len0, len1 int) {
+	if len0 != len1 {
+		panic("vmath: VectorN lengths do not match")
+	}
+}
+
+func checkSize(mat0, mat1 *MatrixN) {
+	if mat0.Rows != mat1.Rows || mat0.Cols != mat1.Cols {
+		panic("vmath: MatrixN sizes do not match")
+	}
+}
+
+// sameData returns true if two slices start at the same element
+func sameData(a, b []float32) bool {
+	return len(a) > 0 && len(b) > 0 && &a[0] == &b[0]
+}
+
+// VectorN
+
+// Resize sets the length to n, keeping the existing elements and zeroing
+// any new ones
+func (result *VectorN) Resize(n int) {
+	if cap(*result) < n {
+		grown := make(VectorN, n)
+		copy(grown, *result)
+		*result = grown
+		return
+	}
+	old := len(*result)
+	*result = (*result)[:n]
+	for i := old; i < n; i++ {
+		(*result)[i] = 0.0
+	}
+}
+
+func (v *VectorN) Len() int {
+	return len(*v)
+}
+
+func (result *VectorN) MakeFromV3(vec *Vector3) {
+	result.Resize(3)
+	copy(*result, vec[:])
+}
+
+func (result *VectorN) MakeFromV4(vec *Vector4) {
+	result.Resize(4)
+	copy(*result, vec[:])
+}
+
+// V3 returns the three elements starting at i
+func (v *VectorN) V3(result *Vector3, i int) {
+	copy(result[:], (*v)[i:i+3])
+}
+
+func (v *VectorN) SetV3(i int, vec *Vector3) {
+	copy((*v)[i:i+3], vec[:])
+}
+
+// V4 returns the four elements starting at i
+func (v *VectorN) V4(result *Vector4, i int) {
+	copy(result[:], (*v)[i:i+4])
+}
+
+func (v *VectorN) SetV4(i int, vec *Vector4) {
+	copy((*v)[i:i+4], vec[:])
+}
+
+func (result *VectorN) Add(vec0, vec1 *VectorN) {
+	checkLen(len(*vec0), len(*vec1))
+	result.Resize(len(*vec0))
+	for i := range *result {
+		(*result)[i] = (*vec0)[i] + (*vec1)[i]
+	}
+}
+
+func (result *VectorN) AddToSelf(vec *VectorN) {
+	result.Add(result, vec)
+}
+
+func (result *VectorN) Sub(vec0, vec1 *VectorN) {
+	checkLen(len(*vec0), len(*vec1))
+	result.Resize(len(*vec0))
+	for i := range *result {
+		(*result)[i] = (*vec0)[i] - (*vec1)[i]
+	}
+}
+
+func (result *VectorN) SubFromSelf(vec *VectorN) {
+	result.Sub(result, vec)
+}
+
+func (result *VectorN) ScalarMul(vec *VectorN, scalar float32) {
+	result.Resize(len(*vec))
+	for i := range *result {
+		(*result)[i] = (*vec)[i] * scalar
+	}
+}
+
+func (result *VectorN) ScalarMulSelf(scalar float32) {
+	result.ScalarMul(result, scalar)
+}
+
+func (v *VectorN) Dot(vec *VectorN) float32 {
+	checkLen(len(*v), len(*vec))
+	result := float32(0.0)
+	for i := range *v {
+		result += (*v)[i] * (*vec)[i]
+	}
+	return result
+}
+
+func (v *VectorN) LengthSqr() float32 {
+	return v.Dot(v)
+}
+
+// Length is the euclidean or 2-norm
+func (v *VectorN) Length() float32 {
+	return sqrt(v.LengthSqr())
+}
+
+// Norm1 is the sum of the absolute values of the elements
+func (v *VectorN) Norm1() float32 {
+	result := float32(0.0)
+	for _, e := range *v {
+		result += abs(e)
+	}
+	return result
+}
+
+// NormInf is the largest absolute value of the elements
+func (v *VectorN) NormInf() float32 {
+	result := float32(0.0)
+	for _, e := range *v {
+		result = max(result, abs(e))
+	}
+	return result
+}
+
+// MulMN multiplies vec by mat, as mat * vec
+func (result *VectorN) MulMN(vec *VectorN, mat *MatrixN) {
+	checkLen(len(*vec), mat.Cols)
+	if sameData(*result, *vec) {
+		tmp := append(VectorN(nil), *vec...)
+		vec = &tmp
+	}
+	result.Resize(mat.Rows)
+	for i := range *result {
+		(*result)[i] = 0.0
+	}
+	for col := 0; col < mat.Cols; col++ {
+		e := (*vec)[col]
+		for row, m := range mat.Data[col*mat.Rows : (col+1)*mat.Rows] {
+			(*result)[row] += m * e
+		}
+	}
+}
+
+// MatrixN
+
+// MakeZero sets the size, reusing the storage where it can, and clears
+// every element
+func (result *MatrixN) MakeZero(rows, cols int) {
+	result.Rows, result.Cols = rows, cols
+	(*VectorN)(&result.Data).Resize(rows * cols)
+	for i := range result.Data {
+		result.Data[i] = 0.0
+	}
+}
+
+func (result *MatrixN) MakeIdentity(n int) {
+	result.MakeZero(n, n)
+	for i := 0; i < n; i++ {
+		result.Data[i*n+i] = 1.0
+	}
+}
+
+func (result *MatrixN) MakeFromM3(mat *Matrix3) {
+	result.MakeZero(3, 3)
+	copy(result.Data, mat[:])
+}
+
+func (result *MatrixN) MakeFromM4(mat *Matrix4) {
+	result.MakeZero(4, 4)
+	copy(result.Data, mat[:])
+}
+
+func (m *MatrixN) Copy(other *MatrixN) {
+	m.Rows, m.Cols = other.Rows, other.Cols
+	(*VectorN)(&m.Data).Resize(len(other.Data))
+	copy(m.Data, other.Data)
+}
+
+func (m *MatrixN) Elem(col, row int) float32 {
+	return m.Data[col*m.Rows+row]
+}
+
+func (m *MatrixN) SetElem(col, row int, val float32) {
+	m.Data[col*m.Rows+row] = val
+}
+
+func (m *MatrixN) Col(result *VectorN, col int) {
+	result.Resize(m.Rows)
+	copy(*result, m.Data[col*m.Rows:(col+1)*m.Rows])
+}
+
+func (m *MatrixN) SetCol(col int, vec *VectorN) {
+	checkLen(len(*vec), m.Rows)
+	copy(m.Data[col*m.Rows:(col+1)*m.Rows], *vec)
+}
+
+func (m *MatrixN) Row(result *VectorN, row int) {
+	result.Resize(m.Cols)
+	for col := range *result {
+		(*result)[col] = m.Data[col*m.Rows+row]
+	}
+}
+
+func (m *MatrixN) SetRow(row int, vec *VectorN) {
+	checkLen(len(*vec), m.Cols)
+	for col, e := range *vec {
+		m.Data[col*m.Rows+row] = e
+	}
+}
+
+// M3 returns the 3x3 block whose first element is at (col, row)
+func (m *MatrixN) M3(result *Matrix3, col, row int) {
+	for j := 0; j < 3; j++ {
+		copy(result[j*3:j*3+3], m.Data[(col+j)*m.Rows+row:])
+	}
+}
+
+// SetM3 overwrites the 3x3 block whose first element is at (col, row)
+func (m *MatrixN) SetM3(col, row int, mat *Matrix3) {
+	for j := 0; j < 3; j++ {
+		copy(m.Data[(col+j)*m.Rows+row:(col+j)*m.Rows+row+3], mat[j*3:j*3+3])
+	}
+}
+
+// M4 returns the 4x4 block whose first element is at (col, row)
+func (m *MatrixN) M4(result *Matrix4, col, row int) {
+	for j := 0; j < 4; j++ {
+		copy(result[j*4:j*4+4], m.Data[(col+j)*m.Rows+row:])
+	}
+}
+
+// SetM4 overwrites the 4x4 block whose first element is at (col, row)
+func (m *MatrixN) SetM4(col, row int, mat *Matrix4) {
+	for j := 0; j < 4; j++ {
+		copy(m.Data[(col+j)*m.Rows+row:(col+j)*m.Rows+row+4], mat[j*4:j*4+4])
+	}
+}
+
+func (result *MatrixN) Transpose(mat *MatrixN) {
+	if sameData(result.Data, mat.Data) {
+		var tmp MatrixN
+		tmp.Copy(mat)
+		mat = &tmp
+	}
+	result.MakeZero(mat.Cols, mat.Rows)
+	for col := 0; col < mat.Cols; col++ {
+		for row := 0; row < mat.Rows; row++ {
+			result.Data[row*result.Rows+col] = mat.Data[col*mat.Rows+row]
+		}
+	}
+}
+
+func (m *MatrixN) TransposeSelf() {
+	m.Transpose(m)
+}
+
+func (result *MatrixN) Add(mat0, mat1 *MatrixN) {
+	checkSize(mat0, mat1)
+	result.Rows, result.Cols = mat0.Rows, mat0.Cols
+	(*VectorN)(&result.Data).Add((*VectorN)(&mat0.Data), (*VectorN)(&mat1.Data))
+}
+
+func (result *MatrixN) AddToSelf(mat *MatrixN) {
+	result.Add(result, mat)
+}
+
+func (result *MatrixN) Sub(mat0, mat1 *MatrixN) {
+	checkSize(mat0, mat1)
+	result.Rows, result.Cols = mat0.Rows, mat0.Cols
+	(*VectorN)(&result.Data).Sub((*VectorN)(&mat0.Data), (*VectorN)(&mat1.Data))
+}
+
+func (result *MatrixN) SubFromSelf(mat *MatrixN) {
+	result.Sub(result, mat)
+}
+
+func (result *MatrixN) ScalarMul(mat *MatrixN, scalar float32) {
+	result.Rows, result.Cols = mat.Rows, mat.Cols
+	(*VectorN)(&result.Data).ScalarMul((*VectorN)(&mat.Data), scalar)
+}
+
+func (result *MatrixN) ScalarMulSelf(scalar float32) {
+	result.ScalarMul(result, scalar)
+}
+
+func (result *MatrixN) Mul(mat0, mat1 *MatrixN) {
+	if mat0.Cols != mat1.Rows {
+		panic("vmath: MatrixN sizes do not match")
+	}
+	if sameData(result.Data, mat0.Data) {
+		var tmp MatrixN
+		tmp.Copy(mat0)
+		mat0 = &tmp
+	}
+	if sameData(result.Data, mat1.Data) {
+		var tmp MatrixN
+		tmp.Copy(mat1)
+		mat1 = &tmp
+	}
+
+	result.MakeZero(mat0.Rows, mat1.Cols)
+	for col := 0; col < mat1.Cols; col++ {
+		dst := result.Data[col*result.Rows : (col+1)*result.Rows]
+		for k := 0; k < mat0.Cols; k++ {
+			e := mat1.Data[col*mat1.Rows+k]
+			if e == 0.0 {
+				continue
+			}
+			for row, m := range mat0.Data[k*mat0.Rows : (k+1)*mat0.Rows] {
+				dst[row] += m * e
+			}
+		}
+	}
+}
+
+func (result *MatrixN) MulSelf(mat *MatrixN) {
+	result.Mul(result, mat)
+}
+
+// Norm is the Frobenius norm, the square root of the sum of the squares of
+// the elements
+func (m *MatrixN) Norm() float32 {
+	return (*VectorN)(&m.Data).Length()
+}
+
+// Norm1 is the largest absolute column sum
+func (m *MatrixN) Norm1() float32 {
+	result := float32(0.0)
+	for col := 0; col < m.Cols; col++ {
+		colData := VectorN(m.Data[col*m.Rows : (col+1)*m.Rows])
+		result = max(result, colData.Norm1())
+	}
+	return result
+}
+
+// NormInf is the largest absolute row sum
+func (m *MatrixN) NormInf() float32 {
+	result := float32(0.0)
+	for row := 0; row < m.Rows; row++ {
+		sum := float32(0.0)
+		for col := 0; col < m.Cols; col++ {
+			sum += abs(m.Data[col*m.Rows+row])
+		}
+		result = max(result, sum)
+	}
+	return result
+}
+
+// LUN
+
+func (result *LUN) MakeFromMN(mat *MatrixN) {
+	if mat.Rows != mat.Cols {
+		panic("vmath: LU of a non-square MatrixN")
+	}
+	result.lu.Copy(mat)
+	if cap(result.perm) < mat.Rows {
+		result.perm = make([]int, mat.Rows)
+	}
+	result.perm = result.perm[:mat.Rows]
+	result.rank, result.sign = luFactor(result.lu.Data, mat.Rows, result.perm)
+}
+
+// Rank returns the number of independent rows of the matrix
+func (lu *LUN) Rank() int {
+	return lu.rank
+}
+
+func (lu *LUN) Determinant() float32 {
+	n := lu.lu.Rows
+	if lu.rank < n {
+		return 0.0
+	}
+	result := lu.sign
+	for i := 0; i < n; i++ {
+		result *= lu.lu.Data[i*n+i]
+	}
+	return result
+}
+
+// Solve finds x such that mat * x = b, returning false if the matrix is
+// singular
+func (lu *LUN) Solve(result, b *VectorN) bool {
+	n := lu.lu.Rows
+	checkLen(len(*b), n)
+	if lu.rank < n {
+		return false
+	}
+	lu.tmp.Resize(n)
+	for i, p := range lu.perm {
+		lu.tmp[i] = (*b)[p]
+	}
+	luSolve(lu.lu.Data, n, lu.tmp)
+	result.Resize(n)
+	copy(*result, lu.tmp)
+	return true
+}
+
+// CholeskyN
+
+// MakeFromMN factors the symmetric matrix mat, reading only its lower
+// triangle, and returns false if it is not positive definite
+func (result *CholeskyN) MakeFromMN(mat *MatrixN) bool {
+	if mat.Rows != mat.Cols {
+		panic("vmath: Cholesky of a non-square MatrixN")
+	}
+	result.l.Copy(mat)
+	return choleskyFactor(result.l.Data, mat.Rows)
+}
+
+// L returns the lower triangular factor
+func (c *CholeskyN) L(result *MatrixN) {
+	result.Copy(&c.l)
+}
+
+func (c *CholeskyN) Solve(result, b *VectorN) {
+	checkLen(len(*b), c.l.Rows)
+	result.Resize(len(*b))
+	copy(*result, *b)
+	choleskySolve(c.l.Data, c.l.Rows, *result)
+}
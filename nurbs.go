@@ -0,0 +1,467 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// NURBSCurve is a non-uniform rational B-spline curve of any degree.  The
+// control points are homogeneous: x, y and z are premultiplied by the
+// weight in w, so a plain B-spline has every w equal to 1.  There must be
+// len(ControlPoints) + Degree + 1 non-decreasing knots, and the degree can
+// be at most NURBSMaxDegree.  The algorithms follow Piegl and Tiller's The
+// NURBS Book.
+type NURBSCurve struct {
+	Degree        int
+	Knots         []float32
+	ControlPoints []Vector4
+}
+
+// NURBSMaxDegree bounds the degree of curves and surfaces so they can be
+// evaluated without allocating
+const NURBSMaxDegree = 10
+
+// nurbsBasis holds basis functions and their derivatives, indexed by
+// derivative then basis function
+type nurbsBasis [NURBSMaxDegree + 1][NURBSMaxDegree + 1]float32
+
+// NURBSSurface is a tensor product NURBS surface.  ControlPoints holds
+// CountU rows of CountV points, so the point i along u and j along v is at
+// index i*CountV + j.
+type NURBSSurface struct {
+	DegreeU, DegreeV int
+	KnotsU, KnotsV   []float32
+	CountU, CountV   int
+	ControlPoints    []Vector4
+}
+
+// clampedKnots returns a uniform knot vector on [0,1] with the ends
+// repeated so the curve starts and ends at its end control points
+func clampedKnots(degree, count int) []float32 {
+	knots := make([]float32, count+degree+1)
+	spans := count - degree
+	for i := range knots {
+		switch {
+		case i <= degree:
+			knots[i] = 0.0
+		case i >= count:
+			knots[i] = 1.0
+		default:
+			knots[i] = float32(i-degree) / float32(spans)
+		}
+	}
+	return knots
+}
+
+// findSpan returns the index of the knot span holding u, where
+// last is the index of the final control point
+func findSpan(degree, last int, knots []float32, u float32) int {
+	if u >= knots[last+1] {
+		// the end of the domain belongs to the last non-empty span
+		span := last
+		for span > degree && knots[span] == knots[span+1] {
+			span--
+		}
+		return span
+	}
+	if u <= knots[degree] {
+		return degree
+	}
+	lo, hi := degree, last+1
+	mid := (lo + hi) / 2
+	for u < knots[mid] || u >= knots[mid+1] {
+		if u < knots[mid] {
+			hi = mid
+		} else {
+			lo = mid
+		}
+		mid = (lo + hi) / 2
+	}
+	return mid
+}
+
+// basisDerivs fills ders with the non-zero basis functions on span and
+// their derivatives: ders[k][j] is the k-th derivative of basis function
+// span-degree+j.  Derivatives beyond the degree are zero.
+func basisDerivs(ders *nurbsBasis, span int, u float32, degree, order int, knots []float32) {
+	p := degree
+	var ndu nurbsBasis
+	var left, right [NURBSMaxDegree + 1]float32
+
+	ndu[0][0] = 1.0
+	for j := 1; j <= p; j++ {
+		left[j] = u - knots[span+1-j]
+		right[j] = knots[span+j] - u
+		saved := float32(0.0)
+		for r := 0; r < j; r++ {
+			// lower triangle holds knot differences
+			ndu[j][r] = right[r+1] + left[j-r]
+			temp := ndu[r][j-1] / ndu[j][r]
+			ndu[r][j] = saved + right[r+1]*temp
+			saved = left[j-r] * temp
+		}
+		ndu[j][j] = saved
+	}
+
+	for j := 0; j <= p; j++ {
+		ders[0][j] = ndu[j][p]
+	}
+
+	n := order
+	if n > p {
+		n = p
+	}
+	for k := n + 1; k <= order && k <= NURBSMaxDegree; k++ {
+		ders[k] = [NURBSMaxDegree + 1]float32{}
+	}
+	var a [2][NURBSMaxDegree + 1]float32
+	for r := 0; r <= p; r++ {
+		s1, s2 := 0, 1
+		a[0][0] = 1.0
+		for k := 1; k <= n; k++ {
+			d := float32(0.0)
+			rk := r - k
+			pk := p - k
+			if r >= k {
+				a[s2][0] = a[s1][0] / ndu[pk+1][rk]
+				d = a[s2][0] * ndu[rk][pk]
+			}
+			j1 := 1
+			if rk < -1 {
+				j1 = -rk
+			}
+			j2 := p - r
+			if r-1 <= pk {
+				j2 = k - 1
+			}
+			for j := j1; j <= j2; j++ {
+				a[s2][j] = (a[s1][j] - a[s1][j-1]) / ndu[pk+1][rk+j]
+				d += a[s2][j] * ndu[rk+j][pk]
+			}
+			if r <= pk {
+				a[s2][k] = -a[s1][k-1] / ndu[pk+1][r]
+				d += a[s2][k] * ndu[r][pk]
+			}
+			ders[k][r] = d
+			s1, s2 = s2, s1
+		}
+	}
+
+	scale := float32(p)
+	for k := 1; k <= n; k++ {
+		for j := 0; j <= p; j++ {
+			ders[k][j] *= scale
+		}
+		scale *= float32(p - k)
+	}
+}
+
+func binomial(n, k int) float32 {
+	result := float32(1.0)
+	for i := 1; i <= k; i++ {
+		result = result * float32(n-k+i) / float32(i)
+	}
+	return result
+}
+
+// rationalDerivs converts derivatives of a homogeneous point into
+// derivatives of its projection with the quotient rule.  Homogeneous
+// derivatives past the end of homogeneous are zero.
+func rationalDerivs(result []Vector3, homogeneous []Vector4) {
+	w0 := homogeneous[0][w]
+	for k := range result {
+		result[k] = Vector3{}
+		if k < len(homogeneous) {
+			homogeneous[k].XYZ(&result[k])
+		}
+		for i := 1; i <= k && i < len(homogeneous); i++ {
+			var term Vector3
+			term.ScalarMul(&result[k-i], binomial(k, i)*homogeneous[i][w])
+			result[k].SubFromSelf(&term)
+		}
+		result[k].ScalarMulSelf(1.0 / w0)
+	}
+}
+
+// insertKnot inserts u times times into knots, returning the new knots and
+// control points.  The knot is never made to repeat more than degree times,
+// and knots at or beyond the ends of the domain are left alone.
+func insertKnot(degree int, knots []float32, pnts []Vector4, u float32, times int) ([]float32, []Vector4) {
+	p := degree
+	last := len(pnts) - 1
+	if u <= knots[p] || u >= knots[last+1] {
+		return knots, pnts
+	}
+	k := findSpan(p, last, knots, u)
+	s := 0
+	for i := k; i >= 0 && knots[i] == u; i-- {
+		s++
+	}
+	if times > p-s {
+		times = p - s
+	}
+	if times <= 0 {
+		return knots, pnts
+	}
+
+	newKnots := make([]float32, len(knots)+times)
+	copy(newKnots, knots[:k+1])
+	for i := 1; i <= times; i++ {
+		newKnots[k+i] = u
+	}
+	copy(newKnots[k+1+times:], knots[k+1:])
+
+	newPnts := make([]Vector4, len(pnts)+times)
+	copy(newPnts, pnts[:k-p+1])
+	copy(newPnts[k-s+times:], pnts[k-s:])
+
+	temp := make([]Vector4, p-s+1)
+	copy(temp, pnts[k-p:k-s+1])
+	var l int
+	for j := 1; j <= times; j++ {
+		l = k - p + j
+		for i := 0; i <= p-j-s; i++ {
+			alpha := (u - knots[l+i]) / (knots[i+k+1] - knots[l+i])
+			temp[i].Lerp(alpha, &temp[i], &temp[i+1])
+		}
+		newPnts[l] = temp[0]
+		newPnts[k+times-j-s] = temp[p-j-s]
+	}
+	for i := l + 1; i < k-s; i++ {
+		newPnts[i] = temp[i-l]
+	}
+	return newKnots, newPnts
+}
+
+// NURBSCurve
+
+// MakeBSpline builds a non-rational curve of the given degree through the
+// end points of pnts and shaped by the rest, with uniform clamped knots on
+// [0,1]
+func (result *NURBSCurve) MakeBSpline(degree int, pnts []Point3) {
+	result.Degree = degree
+	result.Knots = clampedKnots(degree, len(pnts))
+	result.ControlPoints = make([]Vector4, len(pnts))
+	for i := range pnts {
+		result.ControlPoints[i].MakeFromP3(&pnts[i])
+	}
+}
+
+// Domain returns the range of valid parameters
+func (c *NURBSCurve) Domain() (float32, float32) {
+	return c.Knots[c.Degree], c.Knots[len(c.ControlPoints)]
+}
+
+func (c *NURBSCurve) Point(result *Point3, u float32) {
+	var ders [1]Vector3
+	c.Derivatives(ders[:], u)
+	result.MakeFromV3(&ders[0])
+}
+
+func (c *NURBSCurve) Derivative(result *Vector3, u float32) {
+	var ders [2]Vector3
+	c.Derivatives(ders[:], u)
+	*result = ders[1]
+}
+
+// Derivatives fills result with the position at u, as a vector from the
+// origin, followed by as many derivatives as there is room for
+func (c *NURBSCurve) Derivatives(result []Vector3, u float32) {
+	if len(result) == 0 {
+		return
+	}
+	order := len(result) - 1
+	if order > c.Degree {
+		order = c.Degree
+	}
+	span := findSpan(c.Degree, len(c.ControlPoints)-1, c.Knots, u)
+	var basis nurbsBasis
+	basisDerivs(&basis, span, u, c.Degree, order, c.Knots)
+
+	// the homogeneous curve is a polynomial of the degree on each span
+	var homogeneous [NURBSMaxDegree + 1]Vector4
+	for k := 0; k <= order; k++ {
+		for j := 0; j <= c.Degree; j++ {
+			var term Vector4
+			term.ScalarMul(&c.ControlPoints[span-c.Degree+j], basis[k][j])
+			homogeneous[k].AddToSelf(&term)
+		}
+	}
+	rationalDerivs(result, homogeneous[:order+1])
+}
+
+// InsertKnot adds the knot u, times times, without changing the shape of
+// the curve
+func (c *NURBSCurve) InsertKnot(u float32, times int) {
+	c.Knots, c.ControlPoints = insertKnot(c.Degree, c.Knots, c.ControlPoints, u, times)
+}
+
+// NURBSSurface
+
+// MakeBSpline builds a non-rational surface from countU rows of countV
+// points, with uniform clamped knots on [0,1] in each direction
+func (result *NURBSSurface) MakeBSpline(degreeU, degreeV, countU, countV int, pnts []Point3) {
+	result.DegreeU = degreeU
+	result.DegreeV = degreeV
+	result.CountU = countU
+	result.CountV = countV
+	result.KnotsU = clampedKnots(degreeU, countU)
+	result.KnotsV = clampedKnots(degreeV, countV)
+	result.ControlPoints = make([]Vector4, len(pnts))
+	for i := range pnts {
+		result.ControlPoints[i].MakeFromP3(&pnts[i])
+	}
+}
+
+func (s *NURBSSurface) Domain() (uMin, uMax, vMin, vMax float32) {
+	return s.KnotsU[s.DegreeU], s.KnotsU[s.CountU], s.KnotsV[s.DegreeV], s.KnotsV[s.CountV]
+}
+
+func (s *NURBSSurface) Point(result *Point3, u, v float32) {
+	var pnt Vector3
+	s.Derivatives(&pnt, nil, nil, u, v)
+	result.MakeFromV3(&pnt)
+}
+
+// Derivatives evaluates the position, as a vector from the origin, and the
+// partial derivatives along u and v.  Any of them may be nil.
+func (s *NURBSSurface) Derivatives(pnt, du, dv *Vector3, u, v float32) {
+	if pnt == nil && du == nil && dv == nil {
+		return
+	}
+	spanU := findSpan(s.DegreeU, s.CountU-1, s.KnotsU, u)
+	spanV := findSpan(s.DegreeV, s.CountV-1, s.KnotsV, v)
+	var basisU, basisV nurbsBasis
+	basisDerivs(&basisU, spanU, u, s.DegreeU, 1, s.KnotsU)
+	basisDerivs(&basisV, spanV, v, s.DegreeV, 1, s.KnotsV)
+
+	// homogeneous point and its u and v partials
+	var a, au, av Vector4
+	for i := 0; i <= s.DegreeU; i++ {
+		row := (spanU - s.DegreeU + i) * s.CountV
+		for j := 0; j <= s.DegreeV; j++ {
+			var term Vector4
+			ctrl := &s.ControlPoints[row+spanV-s.DegreeV+j]
+			term.ScalarMul(ctrl, basisU[0][i]*basisV[0][j])
+			a.AddToSelf(&term)
+			term.ScalarMul(ctrl, basisU[1][i]*basisV[0][j])
+			au.AddToSelf(&term)
+			term.ScalarMul(ctrl, basisU[0][i]*basisV[1][j])
+			av.AddToSelf(&term)
+		}
+	}
+
+	var ders [2]Vector3
+	homogeneous := [2]Vector4{a, au}
+	rationalDerivs(ders[:], homogeneous[:])
+	if pnt != nil {
+		*pnt = ders[0]
+	}
+	if du != nil {
+		*du = ders[1]
+	}
+	if dv != nil {
+		homogeneous[1] = av
+		rationalDerivs(ders[:], homogeneous[:])
+		*dv = ders[1]
+	}
+}
+
+// Normal returns the unit normal du x dv.  Where that vanishes, as at the
+// poles of a sphere, the surface is sampled slightly towards the middle of
+// its domain.
+func (s *NURBSSurface) Normal(result *Vector3, u, v float32) {
+	var du, dv Vector3
+	s.Derivatives(nil, &du, &dv, u, v)
+	result.Cross(&du, &dv)
+	if result.LengthSqr() > g_EPSILON*g_EPSILON*du.LengthSqr()*dv.LengthSqr() {
+		result.NormalizeSelf()
+		return
+	}
+
+	uMin, uMax, vMin, vMax := s.Domain()
+	const nudge = 1e-3
+	u += nudge * (0.5*(uMin+uMax) - u)
+	v += nudge * (0.5*(vMin+vMax) - v)
+	s.Derivatives(nil, &du, &dv, u, v)
+	result.Cross(&du, &dv)
+	if result.LengthSqr() > 0.0 {
+		result.NormalizeSelf()
+	}
+}
+
+// InsertKnotU adds the knot u, times times, to every row of the surface
+func (s *NURBSSurface) InsertKnotU(u float32, times int) {
+	var knots []float32
+	column := make([]Vector4, s.CountU)
+	var pnts []Vector4
+	for j := 0; j < s.CountV; j++ {
+		for i := 0; i < s.CountU; i++ {
+			column[i] = s.ControlPoints[i*s.CountV+j]
+		}
+		var inserted []Vector4
+		knots, inserted = insertKnot(s.DegreeU, s.KnotsU, column, u, times)
+		if pnts == nil {
+			pnts = make([]Vector4, len(inserted)*s.CountV)
+		}
+		for i := range inserted {
+			pnts[i*s.CountV+j] = inserted[i]
+		}
+	}
+	s.CountU = len(knots) - s.DegreeU - 1
+	s.KnotsU = knots
+	s.ControlPoints = pnts
+}
+
+// InsertKnotV adds the knot v, times times, to every column of the
+// surface
+func (s *NURBSSurface) InsertKnotV(v float32, times int) {
+	var knots []float32
+	var pnts []Vector4
+	for i := 0; i < s.CountU; i++ {
+		var inserted []Vector4
+		row := s.ControlPoints[i*s.CountV : (i+1)*s.CountV]
+		knots, inserted = insertKnot(s.DegreeV, s.KnotsV, row, v, times)
+		pnts = append(pnts, inserted...)
+	}
+	s.CountV = len(knots) - s.DegreeV - 1
+	s.KnotsV = knots
+	s.ControlPoints = pnts
+}
+
+// Tessellate samples the surface on an evenly spaced grid of parameters,
+// appending the positions and normals of (segmentsU+1)*(segmentsV+1)
+// vertices and the indices of two triangles per grid cell, wound
+// counter-clockwise around the normal.  There is always at least one
+// segment in each direction.
+func (s *NURBSSurface) Tessellate(segmentsU, segmentsV int, positions []Point3, normals []Vector3, indices []int) ([]Point3, []Vector3, []int) {
+	if segmentsU < 1 {
+		segmentsU = 1
+	}
+	if segmentsV < 1 {
+		segmentsV = 1
+	}
+	uMin, uMax, vMin, vMax := s.Domain()
+	base := len(positions)
+	for i := 0; i <= segmentsU; i++ {
+		u := uMin + (uMax-uMin)*float32(i)/float32(segmentsU)
+		for j := 0; j <= segmentsV; j++ {
+			v := vMin + (vMax-vMin)*float32(j)/float32(segmentsV)
+			var pnt Point3
+			var normal Vector3
+			s.Point(&pnt, u, v)
+			s.Normal(&normal, u, v)
+			positions = append(positions, pnt)
+			normals = append(normals, normal)
+		}
+	}
+
+	stride := segmentsV + 1
+	for i := 0; i < segmentsU; i++ {
+		for j := 0; j < segmentsV; j++ {
+			v00 := base + i*stride + j
+			v10 := v00 + stride
+			indices = append(indices, v00, v10, v10+1, v00, v10+1, v00+1)
+		}
+	}
+	return positions, normals, indices
+}
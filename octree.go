@@ -0,0 +1,420 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"container/heap"
+)
+
+// Octree partitions space into nested cubes, keeping each item, identified
+// by an integer id, in the deepest node that fully contains its bounds.
+// In a loose octree each node's bounds are enlarged by the looseness
+// factor, so that small items near a split plane still sink down the tree
+// and moving items change nodes less often.  Items that don't fit inside
+// the bounds are kept in the root.  The zero value is a single node that
+// never subdivides until Make gives it bounds.
+type Octree struct {
+	nodes     []octreeNode
+	freeNodes []int
+	items     map[int]*octreeItem
+	maxDepth  int
+	capacity  int
+	looseness float32
+}
+
+type octreeNode struct {
+	center      Point3
+	halfExtents Vector3
+	parent      int
+	children    int
+	depth       int
+	count       int
+	items       []int
+}
+
+type octreeItem struct {
+	box  AABB
+	node int
+}
+
+const octreeNull = -1
+
+// Make resets the tree to cover bounds, subdividing a node once it holds
+// more than capacity items, down to maxDepth levels below the root
+func (result *Octree) Make(bounds *AABB, maxDepth, capacity int) {
+	result.MakeLoose(bounds, maxDepth, capacity, 1.0)
+}
+
+// MakeLoose resets the tree as a loose octree, with node bounds scaled by
+// looseness.  A looseness of 2 is typical.
+func (result *Octree) MakeLoose(bounds *AABB, maxDepth, capacity int, looseness float32) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if looseness < 1.0 {
+		looseness = 1.0
+	}
+	result.maxDepth = maxDepth
+	result.capacity = capacity
+	result.looseness = looseness
+	result.nodes = result.nodes[:0]
+	result.freeNodes = result.freeNodes[:0]
+	result.items = make(map[int]*octreeItem)
+
+	root := octreeNode{parent: octreeNull, children: octreeNull}
+	bounds.Center(&root.center)
+	bounds.HalfExtents(&root.halfExtents)
+	result.nodes = append(result.nodes, root)
+}
+
+func (o *Octree) Len() int {
+	return len(o.items)
+}
+
+func (o *Octree) looseBounds(result *AABB, n int) {
+	var extent Vector3
+	extent.ScalarMul(&o.nodes[n].halfExtents, o.looseness)
+	result.Min.SubV3(&o.nodes[n].center, &extent)
+	result.Max.AddV3(&o.nodes[n].center, &extent)
+}
+
+// childFor picks the child octant holding the center of box, and reports
+// whether the box fits within that child's loose bounds
+func (o *Octree) childFor(n int, box *AABB) (int, bool) {
+	var center Point3
+	var bounds AABB
+	box.Center(&center)
+	node := &o.nodes[n]
+	child := node.children
+	for i := 0; i < 3; i++ {
+		if center[i] >= node.center[i] {
+			child += 1 << uint(i)
+		}
+	}
+	o.looseBounds(&bounds, child)
+	return child, bounds.Contains(box)
+}
+
+// target returns the node an item with the given bounds belongs in
+// without splitting anything
+func (o *Octree) target(box *AABB) int {
+	n := 0
+	for o.nodes[n].children != octreeNull {
+		child, fits := o.childFor(n, box)
+		if !fits {
+			break
+		}
+		n = child
+	}
+	return n
+}
+
+func (o *Octree) Insert(item int, box *AABB) {
+	if o.items == nil {
+		o.items = make(map[int]*octreeItem)
+	}
+	if len(o.nodes) == 0 {
+		o.nodes = append(o.nodes, octreeNode{parent: octreeNull, children: octreeNull})
+	}
+	if _, ok := o.items[item]; ok {
+		o.Remove(item)
+	}
+
+	n := 0
+	for {
+		node := &o.nodes[n]
+		if node.children == octreeNull {
+			if len(node.items) < o.capacity || node.depth >= o.maxDepth {
+				break
+			}
+			o.split(n)
+		}
+		child, fits := o.childFor(n, box)
+		if !fits {
+			break
+		}
+		n = child
+	}
+
+	o.items[item] = &octreeItem{box: *box, node: n}
+	o.nodes[n].items = append(o.nodes[n].items, item)
+	o.addCount(n, 1)
+}
+
+func (o *Octree) InsertPoint(item int, pnt *Point3) {
+	o.Insert(item, &AABB{Min: *pnt, Max: *pnt})
+}
+
+// Move updates an item's bounds, only touching the tree if it has to
+// change nodes
+func (o *Octree) Move(item int, box *AABB) bool {
+	it, ok := o.items[item]
+	if !ok {
+		return false
+	}
+	n := o.target(box)
+	if n == it.node && (o.nodes[n].children != octreeNull || len(o.nodes[n].items) <= o.capacity) {
+		it.box = *box
+		return true
+	}
+	o.Remove(item)
+	o.Insert(item, box)
+	return true
+}
+
+func (o *Octree) MovePoint(item int, pnt *Point3) bool {
+	return o.Move(item, &AABB{Min: *pnt, Max: *pnt})
+}
+
+func (o *Octree) Remove(item int) bool {
+	it, ok := o.items[item]
+	if !ok {
+		return false
+	}
+	delete(o.items, item)
+
+	node := &o.nodes[it.node]
+	for i, other := range node.items {
+		if other == item {
+			last := len(node.items) - 1
+			node.items[i] = node.items[last]
+			node.items = node.items[:last]
+			break
+		}
+	}
+	o.addCount(it.node, -1)
+
+	// fold sparse subtrees back into their parents
+	for n := o.nodes[it.node].parent; n != octreeNull; n = o.nodes[n].parent {
+		if o.nodes[n].count <= o.capacity {
+			o.collapse(n)
+		}
+	}
+	return true
+}
+
+func (o *Octree) addCount(n, delta int) {
+	for ; n != octreeNull; n = o.nodes[n].parent {
+		o.nodes[n].count += delta
+	}
+}
+
+func (o *Octree) split(n int) {
+	var first int
+	if len(o.freeNodes) > 0 {
+		first = o.freeNodes[len(o.freeNodes)-1]
+		o.freeNodes = o.freeNodes[:len(o.freeNodes)-1]
+	} else {
+		first = len(o.nodes)
+		o.nodes = append(o.nodes, make([]octreeNode, 8)...)
+	}
+
+	parent := &o.nodes[n]
+	parent.children = first
+	for i := 0; i < 8; i++ {
+		child := &o.nodes[first+i]
+		*child = octreeNode{
+			parent:   n,
+			children: octreeNull,
+			depth:    parent.depth + 1,
+			items:    child.items[:0],
+		}
+		child.halfExtents.ScalarMul(&parent.halfExtents, 0.5)
+		child.center = parent.center
+		for j := 0; j < 3; j++ {
+			if i&(1<<uint(j)) != 0 {
+				child.center[j] += child.halfExtents[j]
+			} else {
+				child.center[j] -= child.halfExtents[j]
+			}
+		}
+	}
+
+	kept := parent.items[:0]
+	for _, item := range parent.items {
+		it := o.items[item]
+		child, fits := o.childFor(n, &it.box)
+		if !fits {
+			kept = append(kept, item)
+			continue
+		}
+		it.node = child
+		o.nodes[child].items = append(o.nodes[child].items, item)
+		o.nodes[child].count++
+	}
+	o.nodes[n].items = kept
+}
+
+func (o *Octree) collapse(n int) {
+	first := o.nodes[n].children
+	if first == octreeNull {
+		return
+	}
+	for i := first; i < first+8; i++ {
+		o.collapse(i)
+		for _, item := range o.nodes[i].items {
+			o.items[item].node = n
+			o.nodes[n].items = append(o.nodes[n].items, item)
+		}
+		o.nodes[i].items = o.nodes[i].items[:0]
+	}
+	o.nodes[n].children = octreeNull
+	o.freeNodes = append(o.freeNodes, first)
+}
+
+// query visits the nodes whose loose bounds pass test.  Nodes testing
+// Inside have all their items reported without testing them.
+func (o *Octree) query(test func(box *AABB) Containment, fn func(item int) bool) {
+	if len(o.items) == 0 {
+		return
+	}
+	var bounds AABB
+	stack := make([]int, 0, 64)
+	stack = append(stack, 0)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &o.nodes[n]
+		if node.count == 0 {
+			continue
+		}
+		o.looseBounds(&bounds, n)
+		containment := test(&bounds)
+		if n == 0 {
+			// the root also holds whatever lies outside its bounds
+			containment = Intersects
+		}
+		switch containment {
+		case Outside:
+			continue
+		case Inside:
+			if !o.reportAll(n, fn) {
+				return
+			}
+			continue
+		}
+		for _, item := range node.items {
+			if test(&o.items[item].box) != Outside && !fn(item) {
+				return
+			}
+		}
+		if node.children != octreeNull {
+			for i := 0; i < 8; i++ {
+				stack = append(stack, node.children+i)
+			}
+		}
+	}
+}
+
+func (o *Octree) reportAll(n int, fn func(item int) bool) bool {
+	for _, item := range o.nodes[n].items {
+		if !fn(item) {
+			return false
+		}
+	}
+	if o.nodes[n].children != octreeNull {
+		for i := 0; i < 8; i++ {
+			if !o.reportAll(o.nodes[n].children+i, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// QueryAABB calls fn for every item whose bounds overlap box, until fn
+// returns false
+func (o *Octree) QueryAABB(box *AABB, fn func(item int) bool) {
+	o.query(func(bounds *AABB) Containment {
+		if !box.Overlaps(bounds) {
+			return Outside
+		}
+		if box.Contains(bounds) {
+			return Inside
+		}
+		return Intersects
+	}, fn)
+}
+
+// QuerySphere calls fn for every item whose bounds come within the
+// sphere's radius of its center, until fn returns false
+func (o *Octree) QuerySphere(sphere *Sphere, fn func(item int) bool) {
+	var cp ClosestPoints
+	radiusSqr := sphere.Radius * sphere.Radius
+	o.query(func(bounds *AABB) Containment {
+		cp.PointAABB(&sphere.Center, bounds)
+		if cp.DistSqr > radiusSqr {
+			return Outside
+		}
+		return Intersects
+	}, fn)
+}
+
+// QueryFrustum calls fn for every item whose bounds are at least partly
+// inside the frustum, until fn returns false
+func (o *Octree) QueryFrustum(frustum *Frustum, fn func(item int) bool) {
+	o.query(frustum.TestAABB, fn)
+}
+
+// octreeEntry is a node or an item waiting in the best first nearest
+// neighbour search.  Item ids can be any int, so a flag tells them apart.
+type octreeEntry struct {
+	distSqr float32
+	node    int
+	item    int
+	isItem  bool
+}
+
+type octreeQueue []octreeEntry
+
+func (q octreeQueue) Len() int            { return len(q) }
+func (q octreeQueue) Less(i, j int) bool  { return q[i].distSqr < q[j].distSqr }
+func (q octreeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *octreeQueue) Push(e interface{}) { *q = append(*q, e.(octreeEntry)) }
+func (q *octreeQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// KNearest appends to result, in order of increasing distance, the k items
+// whose bounds are closest to pnt
+func (o *Octree) KNearest(pnt *Point3, k int, result []int) []int {
+	result = result[:0]
+	if len(o.items) == 0 || k <= 0 {
+		return result
+	}
+
+	var cp ClosestPoints
+	var bounds AABB
+	queue := &octreeQueue{{node: 0}}
+	for queue.Len() > 0 && len(result) < k {
+		e := heap.Pop(queue).(octreeEntry)
+		if e.isItem {
+			// nothing left in the queue can be closer than this item
+			result = append(result, e.item)
+			continue
+		}
+
+		node := &o.nodes[e.node]
+		for _, item := range node.items {
+			cp.PointAABB(pnt, &o.items[item].box)
+			heap.Push(queue, octreeEntry{distSqr: cp.DistSqr, node: e.node, item: item, isItem: true})
+		}
+		if node.children == octreeNull {
+			continue
+		}
+		for i := node.children; i < node.children+8; i++ {
+			if o.nodes[i].count == 0 {
+				continue
+			}
+			o.looseBounds(&bounds, i)
+			cp.PointAABB(pnt, &bounds)
+			heap.Push(queue, octreeEntry{distSqr: cp.DistSqr, node: i})
+		}
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// Orthonormalize makes mat a rotation by Gram-Schmidt.  The column axis
+// (0, 1 or 2 for x, y or z) keeps its direction, the next column in cyclic
+// order is made perpendicular to it, and the last is their cross product,
+// so the result is always right handed.  Use it to correct the drift that
+// builds up over many multiplications.
+func (result *Matrix3) Orthonormalize(mat *Matrix3, axis int) {
+	var cols [3]Vector3
+	a, b, c := axis, (axis+1)%3, (axis+2)%3
+	mat.Col(&cols[a], a)
+	mat.Col(&cols[b], b)
+
+	if cols[a].LengthSqr() < g_EPSILON*g_EPSILON {
+		cols[a] = Vector3{}
+		cols[a][a] = 1.0
+	}
+	cols[a].NormalizeSelf()
+
+	var along Vector3
+	along.ScalarMul(&cols[a], cols[b].Dot(&cols[a]))
+	cols[b].SubFromSelf(&along)
+	if cols[b].LengthSqr() < g_EPSILON*g_EPSILON {
+		perpendicular(&cols[b], &cols[a])
+	}
+	cols[b].NormalizeSelf()
+	cols[c].Cross(&cols[a], &cols[b])
+
+	result.MakeFromCols(&cols[0], &cols[1], &cols[2])
+}
+
+func (result *Matrix3) OrthonormalizeSelf(axis int) {
+	result.Orthonormalize(result, axis)
+}
+
+// IsOrthonormal returns true if the columns are unit length and at right
+// angles to each other, to within tolerance
+func (m *Matrix3) IsOrthonormal(tolerance float32) bool {
+	var cols [3]Vector3
+	for i := range cols {
+		m.Col(&cols[i], i)
+	}
+	for i := range cols {
+		for j := i; j < 3; j++ {
+			want := float32(0.0)
+			if i == j {
+				want = 1.0
+			}
+			if abs(cols[i].Dot(&cols[j])-want) > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Orthonormalize makes the upper 3x3 of tfrm a rotation, keeping the
+// translation
+func (result *Transform3) Orthonormalize(tfrm *Transform3, axis int) {
+	var upper Matrix3
+	tfrm.Upper3x3(&upper)
+	upper.OrthonormalizeSelf(axis)
+	*result = *tfrm
+	result.SetUpper3x3(&upper)
+}
+
+func (result *Transform3) OrthonormalizeSelf(axis int) {
+	result.Orthonormalize(result, axis)
+}
+
+func (t *Transform3) IsOrthonormal(tolerance float32) bool {
+	var upper Matrix3
+	t.Upper3x3(&upper)
+	return upper.IsOrthonormal(tolerance)
+}
+
+// Orthonormalize makes the upper 3x3 of mat a rotation, keeping the rest
+func (result *Matrix4) Orthonormalize(mat *Matrix4, axis int) {
+	var upper Matrix3
+	mat.Upper3x3(&upper)
+	upper.OrthonormalizeSelf(axis)
+	*result = *mat
+	result.SetUpper3x3(&upper)
+}
+
+func (result *Matrix4) OrthonormalizeSelf(axis int) {
+	result.Orthonormalize(result, axis)
+}
+
+// IsOrthonormal checks the upper 3x3 only
+func (m *Matrix4) IsOrthonormal(tolerance float32) bool {
+	var upper Matrix3
+	m.Upper3x3(&upper)
+	return upper.IsOrthonormal(tolerance)
+}
@@ -157,6 +157,67 @@ func (result *Quaternion) SlerpSelf(t float32, unitQuatTo *Quaternion) {
 	result.Slerp(t, &tmp, unitQuatTo)
 }
 
+// Nlerp blends linearly along the shorter arc and normalizes.  It follows
+// the same path as Slerp but not at constant speed, running fastest at
+// the middle, which is often invisible for the small steps between
+// animation keys.
+func (result *Quaternion) Nlerp(t float32, unitQuat0, unitQuat1 *Quaternion) {
+	// like Slerp, flip the start to take the shorter arc
+	scale0 := 1.0 - t
+	if unitQuat0.Dot(unitQuat1) < 0.0 {
+		scale0 = -scale0
+	}
+	scale1 := t
+	for i := 0; i < 4; i++ {
+		result[i] = scale0*unitQuat0[i] + scale1*unitQuat1[i]
+	}
+	result.NormalizeSelf()
+}
+
+func (result *Quaternion) NlerpSelf(t float32, unitQuatTo *Quaternion) {
+	result.Nlerp(t, result, unitQuatTo)
+}
+
+// Eberly's polynomial coefficients for sin(t*angle) / sin(angle), with the
+// last term corrected to balance the truncation error
+const fastSlerpMu = 1.85298109240830
+
+var fastSlerpU = [8]float32{1.0 / 3.0, 1.0 / 10.0, 1.0 / 21.0, 1.0 / 36.0, 1.0 / 55.0, 1.0 / 78.0, 1.0 / 105.0, fastSlerpMu / 136.0}
+var fastSlerpV = [8]float32{1.0 / 3.0, 2.0 / 5.0, 3.0 / 7.0, 4.0 / 9.0, 5.0 / 11.0, 6.0 / 13.0, 7.0 / 15.0, fastSlerpMu * 8.0 / 17.0}
+
+// FastSlerp approximates Slerp with Eberly's polynomial, without any
+// trigonometry or division.  The blend weights are within 2e-5 of the
+// exact ones for every t in [0, 1] and every pair of unit quaternions,
+// taking the shorter arc, so the result is within about 4e-5 of the
+// Slerp result and of unit length.
+func (result *Quaternion) FastSlerp(t float32, unitQuat0, unitQuat1 *Quaternion) {
+	cosAngle := unitQuat0.Dot(unitQuat1)
+	sign := float32(1.0)
+	if cosAngle < 0.0 {
+		cosAngle = -cosAngle
+		sign = -1.0
+	}
+
+	xm1 := cosAngle - 1.0
+	d := 1.0 - t
+	sqrT := t * t
+	sqrD := d * d
+	scaleT, scaleD := float32(1.0), float32(1.0)
+	for i := len(fastSlerpU) - 1; i >= 0; i-- {
+		scaleT = 1.0 + (fastSlerpU[i]*sqrT-fastSlerpV[i])*xm1*scaleT
+		scaleD = 1.0 + (fastSlerpU[i]*sqrD-fastSlerpV[i])*xm1*scaleD
+	}
+	scale0 := sign * d * scaleD
+	scale1 := t * scaleT
+	for i := 0; i < 4; i++ {
+		result[i] = scale0*unitQuat0[i] + scale1*unitQuat1[i]
+	}
+}
+
+func (result *Quaternion) FastSlerpSelf(t float32, unitQuatTo *Quaternion) {
+	result.FastSlerp(t, result, unitQuatTo)
+}
+
 func (result *Quaternion) Squad(t float32, unitQuat0, unitQuat1, unitQuat2, unitQuat3 *Quaternion) {
 	var tmp0, tmp1 Quaternion
 	tmp0.Slerp(t, unitQuat0, unitQuat3)
@@ -318,7 +379,8 @@ func (result *Quaternion) Mul(quat0, quat1 *Quaternion) {
 	}
 
 	if unsafe.Pointer(result) == unsafe.Pointer(quat1) {
-		result.MulSelf(quat0)
+		tmp := *result
+		result.Mul(quat0, &tmp)
 		return
 	}
 	result[x] = (quat0[w] * quat1[x]) + (quat0[x] * quat1[w]) + (quat0[y] * quat1[z]) - (quat0[z] * quat1[y])
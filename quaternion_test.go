@@ -0,0 +1,158 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuaternionMulAliasing(t *testing.T) {
+	a := Quaternion{0.1, -0.4, 0.3, 0.8}
+	b := Quaternion{0.5, 0.2, -0.6, 0.4}
+	var want Quaternion
+	want.Mul(&a, &b)
+	q := b
+	q.Mul(&a, &q)
+	if q != want {
+		t.Error("quaternion mul into second operand", q, want)
+	}
+	q = a
+	q.Mul(&q, &b)
+	if q != want {
+		t.Error("quaternion mul into first operand", q, want)
+	}
+}
+
+// quatAngle returns the rotation angle between two unit quaternions
+func quatAngle(quat0, quat1 *Quaternion) float32 {
+	return 2 * acos(min(abs(quat0.Dot(quat1)), 1))
+}
+
+func TestQuaternionAverage(t *testing.T) {
+	axis := Vector3{1, 2, -2}
+	axis.NormalizeSelf()
+	quats := make([]Quaternion, 3)
+	quats[0].MakeRotationAxis(0, &axis)
+	quats[1].MakeRotationAxis(0, &axis)
+	quats[2].MakeRotationAxis(1.2, &axis)
+	// q and -q are the same rotation
+	quats[1].NegSelf()
+
+	var want, avg Quaternion
+	want.MakeRotationAxis(0.4, &axis)
+	avg.KarcherMean(quats, nil)
+	if quatAngle(&avg, &want) > 1e-3 || !nearlyEqual(avg.Length(), 1) {
+		t.Error("karcher mean", avg, want)
+	}
+	// the cheaper averages minimise chordal rather than angular distance,
+	// so only come close
+	avg.Average(quats, nil)
+	if quatAngle(&avg, &want) > 0.05 || !nearlyEqual(avg.Length(), 1) {
+		t.Error("markley average", avg, want)
+	}
+	avg.NlerpBlend(quats, nil)
+	if quatAngle(&avg, &want) > 0.05 || !nearlyEqual(avg.Length(), 1) {
+		t.Error("nlerp blend", avg, want)
+	}
+
+	// weights pick out rotations
+	weights := []float32{0, 0, 1}
+	for name, fn := range map[string]func([]Quaternion, []float32){
+		"karcher": avg.KarcherMean, "markley": avg.Average, "nlerp": avg.NlerpBlend} {
+		fn(quats, weights)
+		if quatAngle(&avg, &quats[2]) > 1e-3 {
+			t.Error(name, "weighted average", avg)
+		}
+	}
+
+	// rotations about different axes average symmetrically
+	var rotX, rotY, mean Quaternion
+	rotX.MakeRotationX(0.5)
+	rotY.MakeRotationY(0.5)
+	pair := []Quaternion{rotX, rotY}
+	mean.KarcherMean(pair, nil)
+	if !nearlyEqual(quatAngle(&mean, &rotX), quatAngle(&mean, &rotY)) {
+		t.Error("karcher mean symmetry", quatAngle(&mean, &rotX), quatAngle(&mean, &rotY))
+	}
+	avg.Average(pair, nil)
+	if quatAngle(&avg, &mean) > 1e-3 {
+		t.Error("markley matches karcher for two rotations", avg, mean)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("short weights should panic")
+			}
+		}()
+		avg.NlerpBlend(quats, weights[:2])
+	}()
+
+	avg.Average(nil, nil)
+	mean.NlerpBlend(nil, nil)
+	if avg != (Quaternion{0, 0, 0, 1}) || mean != (Quaternion{0, 0, 0, 1}) {
+		t.Error("average of nothing", avg, mean)
+	}
+}
+
+// exactSlerp is Slerp in float64, without its linear fallback for nearby
+// quaternions
+func exactSlerp(t float32, quat0, quat1 *Quaternion) Quaternion {
+	cosAngle := float64(quat0.Dot(quat1))
+	sign := 1.0
+	if cosAngle < 0 {
+		cosAngle, sign = -cosAngle, -1
+	}
+	angle := math.Acos(math.Min(cosAngle, 1))
+	scale0, scale1 := 1-float64(t), float64(t)
+	if angle > 1e-9 {
+		scale0 = math.Sin((1-float64(t))*angle) / math.Sin(angle)
+		scale1 = math.Sin(float64(t)*angle) / math.Sin(angle)
+	}
+	var result Quaternion
+	for i := range result {
+		result[i] = float32(sign*scale0*float64(quat0[i]) + scale1*float64(quat1[i]))
+	}
+	return result
+}
+
+func TestQuaternionFastSlerp(t *testing.T) {
+	axis := Vector3{1, 2, -2}
+	axis.NormalizeSelf()
+	var quat0, quat1, slerp, fast, nlerp Quaternion
+	quat0.MakeRotationAxis(0.3, &axis)
+	maxErr := float32(0)
+	for deg := 0; deg <= 360; deg += 5 {
+		var other Vector3
+		other.Cross(&axis, &Vector3{0, 0, 1})
+		other.NormalizeSelf()
+		quat1.MakeRotationAxis(float32(deg)*math.Pi/180, &other)
+		quat1.MulSelf(&quat0)
+		for i := 0; i <= 20; i++ {
+			tt := float32(i) / 20
+			slerp = exactSlerp(tt, &quat0, &quat1)
+			fast.FastSlerp(tt, &quat0, &quat1)
+			for j := range fast {
+				maxErr = max(maxErr, abs(fast[j]-slerp[j]))
+			}
+			nlerp.Nlerp(tt, &quat0, &quat1)
+			if !nearlyEqual(nlerp.Length(), 1) || (i == 10 && quatAngle(&nlerp, &slerp) > 1e-3) {
+				t.Error("nlerp", deg, tt, nlerp, slerp)
+			}
+		}
+	}
+	if maxErr > 4e-5 {
+		t.Error("fast slerp error", maxErr)
+	}
+
+	fast = quat0
+	fast.FastSlerpSelf(1, &quat1)
+	nlerp = quat0
+	nlerp.NlerpSelf(0, &quat1)
+	if quatAngle(&fast, &quat1) > 1e-3 || quatAngle(&nlerp, &quat0) > 1e-3 {
+		t.Error("slerp ends", fast, nlerp)
+	}
+}
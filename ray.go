@@ -0,0 +1,364 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+)
+
+type Ray struct {
+	Origin    Point3
+	Direction Vector3
+}
+
+// RayHit describes where a ray struck a surface.  Distance is the ray
+// parameter of the hit, which is the true distance when the ray direction
+// is unit length.  For closed shapes a ray starting inside reports the
+// point where it exits.  U and V are the barycentric weights of the second
+// and third vertex for triangle hits.
+type RayHit struct {
+	Distance float32
+	Point    Point3
+	Normal   Vector3
+	U, V     float32
+}
+
+func (result *Ray) MakeFromPoints(start, end *Point3) {
+	result.Origin = *start
+	result.Direction.P3Sub(end, start)
+	result.Direction.NormalizeSelf()
+}
+
+func (r *Ray) PointAt(result *Point3, t float32) {
+	var tmpV3 Vector3
+	tmpV3.ScalarMul(&r.Direction, t)
+	result.AddV3(&r.Origin, &tmpV3)
+}
+
+func (r *Ray) setHit(hit *RayHit, t float32) {
+	hit.Distance = t
+	hit.U = 0.0
+	hit.V = 0.0
+	r.PointAt(&hit.Point, t)
+}
+
+// IntersectPlane reports the plane normal as the hit normal regardless of
+// which side the ray approaches from
+func (r *Ray) IntersectPlane(plane *Plane, hit *RayHit) bool {
+	var normal Vector3
+	plane.Normal(&normal)
+	denom := normal.Dot(&r.Direction)
+	if abs(denom) < g_EPSILON {
+		return false
+	}
+	t := -plane.Dist(&r.Origin) / denom
+	if t < 0.0 {
+		return false
+	}
+	r.setHit(hit, t)
+	hit.Normal = normal
+	return true
+}
+
+// IntersectAABB uses the slab method
+func (r *Ray) IntersectAABB(box *AABB, hit *RayHit) bool {
+	tMin := float32(-math.MaxFloat32)
+	tMax := float32(math.MaxFloat32)
+	enterAxis, exitAxis := -1, -1
+
+	for i := 0; i < 3; i++ {
+		if abs(r.Direction[i]) < g_EPSILON {
+			if r.Origin[i] < box.Min[i] || r.Origin[i] > box.Max[i] {
+				return false
+			}
+			continue
+		}
+		ood := 1.0 / r.Direction[i]
+		t1 := (box.Min[i] - r.Origin[i]) * ood
+		t2 := (box.Max[i] - r.Origin[i]) * ood
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > tMin {
+			tMin = t1
+			enterAxis = i
+		}
+		if t2 < tMax {
+			tMax = t2
+			exitAxis = i
+		}
+		if tMin > tMax {
+			return false
+		}
+	}
+
+	if exitAxis < 0 || tMax < 0.0 {
+		return false
+	}
+
+	hit.Normal = Vector3{}
+	if tMin >= 0.0 {
+		r.setHit(hit, tMin)
+		if r.Direction[enterAxis] > 0.0 {
+			hit.Normal[enterAxis] = -1.0
+		} else {
+			hit.Normal[enterAxis] = 1.0
+		}
+		return true
+	}
+
+	r.setHit(hit, tMax)
+	if r.Direction[exitAxis] > 0.0 {
+		hit.Normal[exitAxis] = 1.0
+	} else {
+		hit.Normal[exitAxis] = -1.0
+	}
+	return true
+}
+
+func (r *Ray) IntersectSphere(sphere *Sphere, hit *RayHit) bool {
+	t0, t1, ok := r.sphereInterval(&sphere.Center, sphere.Radius)
+	if !ok || t1 < 0.0 {
+		return false
+	}
+	if t0 >= 0.0 {
+		r.setHit(hit, t0)
+	} else {
+		r.setHit(hit, t1)
+	}
+	hit.Normal.P3Sub(&hit.Point, &sphere.Center)
+	hit.Normal.NormalizeSelf()
+	return true
+}
+
+// IntersectOBB runs the slab test in the box's local frame
+func (r *Ray) IntersectOBB(box *OBB, hit *RayHit) bool {
+	var local Ray
+	var localBox AABB
+	var axis Vector3
+
+	box.ToLocal((*Vector3)(&local.Origin), &r.Origin)
+	for i := 0; i < 3; i++ {
+		box.Axes.Col(&axis, i)
+		local.Direction[i] = r.Direction.Dot(&axis)
+	}
+	localBox.Min.SubV3(&localBox.Min, &box.HalfExtents)
+	localBox.Max.AddV3(&localBox.Max, &box.HalfExtents)
+
+	if !local.IntersectAABB(&localBox, hit) {
+		return false
+	}
+
+	r.PointAt(&hit.Point, hit.Distance)
+	hit.Normal.MulM3Self(&box.Axes)
+	return true
+}
+
+// IntersectTriangle uses the Möller–Trumbore algorithm and hits both faces.
+// The normal is the face normal for counter-clockwise winding of pnt0,
+// pnt1, pnt2.
+func (r *Ray) IntersectTriangle(pnt0, pnt1, pnt2 *Point3, hit *RayHit) bool {
+	var edge0, edge1, normal, p, s, q Vector3
+
+	edge0.P3Sub(pnt1, pnt0)
+	edge1.P3Sub(pnt2, pnt0)
+	normal.Cross(&edge0, &edge1)
+	p.Cross(&r.Direction, &edge1)
+	det := edge0.Dot(&p)
+	// det is the cosine between the ray and the normal scaled by both
+	// their lengths, so parallel rays are rejected relative to those
+	if abs(det) <= g_EPSILON*r.Direction.Length()*normal.Length() {
+		return false
+	}
+	detInv := 1.0 / det
+
+	s.P3Sub(&r.Origin, pnt0)
+	u := s.Dot(&p) * detInv
+	if u < 0.0 || u > 1.0 {
+		return false
+	}
+
+	q.Cross(&s, &edge0)
+	v := r.Direction.Dot(&q) * detInv
+	if v < 0.0 || u+v > 1.0 {
+		return false
+	}
+
+	t := edge1.Dot(&q) * detInv
+	if t < 0.0 {
+		return false
+	}
+
+	r.setHit(hit, t)
+	hit.U = u
+	hit.V = v
+	hit.Normal.Normalize(&normal)
+	return true
+}
+
+// IntersectCapsule tests against the capsule swept by a sphere of radius
+// moving from pnt0 to pnt1
+func (r *Ray) IntersectCapsule(pnt0, pnt1 *Point3, radius float32, hit *RayHit) bool {
+	tIn := float32(math.MaxFloat32)
+	tOut := float32(-math.MaxFloat32)
+	found := false
+
+	// the capsule is convex, so the union of the intervals for the two
+	// end spheres and the cylindrical body is a single interval
+	if t0, t1, ok := r.sphereInterval(pnt0, radius); ok {
+		tIn, tOut, found = min(tIn, t0), max(tOut, t1), true
+	}
+	if t0, t1, ok := r.sphereInterval(pnt1, radius); ok {
+		tIn, tOut, found = min(tIn, t0), max(tOut, t1), true
+	}
+	if c0, c1, ok := r.cylinderInterval(pnt0, pnt1, radius); ok {
+		if s0, s1, ok := r.slabInterval(pnt0, pnt1); ok {
+			t0, t1 := max(c0, s0), min(c1, s1)
+			if t0 <= t1 {
+				tIn, tOut, found = min(tIn, t0), max(tOut, t1), true
+			}
+		}
+	}
+
+	if !found || tOut < 0.0 {
+		return false
+	}
+	if tIn >= 0.0 {
+		r.setHit(hit, tIn)
+	} else {
+		r.setHit(hit, tOut)
+	}
+
+	var closest Point3
+	closest.Lerp(closestSegmentParam(&hit.Point, pnt0, pnt1), pnt0, pnt1)
+	hit.Normal.P3Sub(&hit.Point, &closest)
+	hit.Normal.NormalizeSelf()
+	return true
+}
+
+// IntersectCylinder tests against the capped cylinder with end cap centers
+// at pnt0 and pnt1
+func (r *Ray) IntersectCylinder(pnt0, pnt1 *Point3, radius float32, hit *RayHit) bool {
+	c0, c1, ok := r.cylinderInterval(pnt0, pnt1, radius)
+	if !ok {
+		return false
+	}
+	s0, s1, ok := r.slabInterval(pnt0, pnt1)
+	if !ok {
+		return false
+	}
+
+	tIn, tOut := max(c0, s0), min(c1, s1)
+	if tIn > tOut || tOut < 0.0 {
+		return false
+	}
+
+	var axis Vector3
+	axis.P3Sub(pnt1, pnt0)
+	axis.NormalizeSelf()
+
+	var onCap bool
+	if tIn >= 0.0 {
+		r.setHit(hit, tIn)
+		onCap = s0 > c0
+	} else {
+		r.setHit(hit, tOut)
+		onCap = s1 < c1
+	}
+
+	if onCap {
+		var fromStart Vector3
+		fromStart.P3Sub(&hit.Point, pnt0)
+		if fromStart.Dot(&axis) > 0.5*pnt0.Dist(pnt1) {
+			hit.Normal = axis
+		} else {
+			hit.Normal.Neg(&axis)
+		}
+		return true
+	}
+
+	var closest Point3
+	closest.Lerp(closestSegmentParam(&hit.Point, pnt0, pnt1), pnt0, pnt1)
+	hit.Normal.P3Sub(&hit.Point, &closest)
+	hit.Normal.NormalizeSelf()
+	return true
+}
+
+// sphereInterval returns the ray parameters where the ray's line enters and
+// leaves the sphere
+func (r *Ray) sphereInterval(center *Point3, radius float32) (float32, float32, bool) {
+	var m Vector3
+	m.P3Sub(&r.Origin, center)
+	a := r.Direction.LengthSqr()
+	if a < g_EPSILON {
+		return 0, 0, false
+	}
+	b := m.Dot(&r.Direction)
+	c := m.LengthSqr() - radius*radius
+	disc := b*b - a*c
+	if disc < 0.0 {
+		return 0, 0, false
+	}
+	root := sqrt(disc)
+	return (-b - root) / a, (-b + root) / a, true
+}
+
+// cylinderInterval returns the ray parameters where the ray's line enters
+// and leaves the infinite cylinder around the line through pnt0 and pnt1
+func (r *Ray) cylinderInterval(pnt0, pnt1 *Point3, radius float32) (float32, float32, bool) {
+	var d, m Vector3
+	d.P3Sub(pnt1, pnt0)
+	m.P3Sub(&r.Origin, pnt0)
+	n := &r.Direction
+
+	md := m.Dot(&d)
+	nd := n.Dot(&d)
+	dd := d.Dot(&d)
+	nn := n.Dot(n)
+	mn := m.Dot(n)
+
+	a := dd*nn - nd*nd
+	c := dd*(m.Dot(&m)-radius*radius) - md*md
+	if abs(a) < g_EPSILON*dd*nn {
+		// parallel to the axis
+		if c > 0.0 {
+			return 0, 0, false
+		}
+		return float32(-math.MaxFloat32), float32(math.MaxFloat32), true
+	}
+
+	b := dd*mn - nd*md
+	disc := b*b - a*c
+	if disc < 0.0 {
+		return 0, 0, false
+	}
+	root := sqrt(disc)
+	return (-b - root) / a, (-b + root) / a, true
+}
+
+// slabInterval returns the ray parameters where the ray's line is between
+// the planes through pnt0 and pnt1 perpendicular to the segment
+func (r *Ray) slabInterval(pnt0, pnt1 *Point3) (float32, float32, bool) {
+	var d, m Vector3
+	d.P3Sub(pnt1, pnt0)
+	m.P3Sub(&r.Origin, pnt0)
+
+	md := m.Dot(&d)
+	nd := r.Direction.Dot(&d)
+	dd := d.Dot(&d)
+	if abs(nd) < g_EPSILON*dd {
+		if md < 0.0 || md > dd {
+			return 0, 0, false
+		}
+		return float32(-math.MaxFloat32), float32(math.MaxFloat32), true
+	}
+
+	t0 := -md / nd
+	t1 := (dd - md) / nd
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	return t0, t1, true
+}
@@ -0,0 +1,371 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"sort"
+)
+
+// SparseMatrix is a matrix in compressed sparse row form.  The entries of
+// row r are Values[RowStart[r]:RowStart[r+1]], in increasing column order
+// with the columns given by ColIndex.
+type SparseMatrix struct {
+	Rows, Cols int
+	RowStart   []int
+	ColIndex   []int
+	Values     []float32
+}
+
+// SparseBuilder collects entries in any order to build a SparseMatrix.
+// Entries added more than once at the same position are summed, which
+// suits assembling per-element contributions.
+type SparseBuilder struct {
+	Rows, Cols int
+	triplets   []sparseTriplet
+}
+
+type sparseTriplet struct {
+	row, col int
+	val      float32
+}
+
+// Preconditioner approximately solves a system for ConjugateGradient.
+// Apply sets result to an approximation of inverse(A) * vec.
+type Preconditioner interface {
+	Apply(result, vec *VectorN)
+}
+
+// JacobiPreconditioner scales by the inverse of the diagonal.  It is cheap
+// to build and helps when the diagonal varies widely.
+type JacobiPreconditioner struct {
+	inv VectorN
+}
+
+// IncompleteCholesky is the zero fill-in incomplete Cholesky factorisation
+// of a symmetric positive definite matrix, L * transpose(L) with L keeping
+// the sparsity of the lower triangle.  It usually cuts the iteration count
+// well below Jacobi's.
+type IncompleteCholesky struct {
+	l SparseMatrix
+}
+
+// ConjugateGradient solves symmetric positive definite sparse systems.
+// The scratch vectors are kept between calls, so reusing one solver
+// avoids allocating.
+type ConjugateGradient struct {
+	// MaxIterations defaults to the number of rows when zero
+	MaxIterations int
+	// Tolerance is the residual to reach relative to the right hand side,
+	// defaulting to 1e-5 when zero
+	Tolerance float32
+
+	r, z, p, q VectorN
+}
+
+// SparseBuilder
+
+// Reset empties the builder for a matrix of the given size, keeping its
+// storage
+func (b *SparseBuilder) Reset(rows, cols int) {
+	b.Rows, b.Cols = rows, cols
+	b.triplets = b.triplets[:0]
+}
+
+func (b *SparseBuilder) Add(col, row int, val float32) {
+	b.triplets = append(b.triplets, sparseTriplet{row: row, col: col, val: val})
+}
+
+// AddM3 adds a 3x3 block whose first element is at (col, row)
+func (b *SparseBuilder) AddM3(col, row int, mat *Matrix3) {
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			b.Add(col+j, row+i, mat.Elem(j, i))
+		}
+	}
+}
+
+func (b *SparseBuilder) Build(result *SparseMatrix) {
+	sort.Slice(b.triplets, func(i, j int) bool {
+		if b.triplets[i].row != b.triplets[j].row {
+			return b.triplets[i].row < b.triplets[j].row
+		}
+		return b.triplets[i].col < b.triplets[j].col
+	})
+
+	result.Rows, result.Cols = b.Rows, b.Cols
+	result.ColIndex = result.ColIndex[:0]
+	result.Values = result.Values[:0]
+	if cap(result.RowStart) < b.Rows+1 {
+		result.RowStart = make([]int, b.Rows+1)
+	}
+	result.RowStart = result.RowStart[:b.Rows+1]
+
+	row := 0
+	result.RowStart[0] = 0
+	for i, t := range b.triplets {
+		if i > 0 && t.row == b.triplets[i-1].row && t.col == b.triplets[i-1].col {
+			result.Values[len(result.Values)-1] += t.val
+			continue
+		}
+		for row < t.row {
+			row++
+			result.RowStart[row] = len(result.Values)
+		}
+		result.ColIndex = append(result.ColIndex, t.col)
+		result.Values = append(result.Values, t.val)
+	}
+	for row < b.Rows {
+		row++
+		result.RowStart[row] = len(result.Values)
+	}
+}
+
+// SparseMatrix
+
+// NonZeros returns the number of stored entries
+func (m *SparseMatrix) NonZeros() int {
+	return len(m.Values)
+}
+
+// find returns the index into Values of (col, row), or -1 if it is not
+// stored
+func (m *SparseMatrix) find(col, row int) int {
+	start, end := m.RowStart[row], m.RowStart[row+1]
+	i := start + sort.SearchInts(m.ColIndex[start:end], col)
+	if i < end && m.ColIndex[i] == col {
+		return i
+	}
+	return -1
+}
+
+func (m *SparseMatrix) Elem(col, row int) float32 {
+	if i := m.find(col, row); i >= 0 {
+		return m.Values[i]
+	}
+	return 0.0
+}
+
+// M3 returns the 3x3 block whose first element is at (col, row)
+func (m *SparseMatrix) M3(result *Matrix3, col, row int) {
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			result.SetElem(j, i, m.Elem(col+j, row+i))
+		}
+	}
+}
+
+// Diagonal returns the diagonal entries
+func (m *SparseMatrix) Diagonal(result *VectorN) {
+	n := m.Rows
+	if m.Cols < n {
+		n = m.Cols
+	}
+	result.Resize(n)
+	for i := range *result {
+		(*result)[i] = m.Elem(i, i)
+	}
+}
+
+// MulSparse multiplies vec by mat, as mat * vec
+func (result *VectorN) MulSparse(vec *VectorN, mat *SparseMatrix) {
+	checkLen(len(*vec), mat.Cols)
+	if sameData(*result, *vec) {
+		tmp := append(VectorN(nil), *vec...)
+		vec = &tmp
+	}
+	result.Resize(mat.Rows)
+	for row := range *result {
+		sum := float32(0.0)
+		for i := mat.RowStart[row]; i < mat.RowStart[row+1]; i++ {
+			sum += mat.Values[i] * (*vec)[mat.ColIndex[i]]
+		}
+		(*result)[row] = sum
+	}
+}
+
+// AddScaled sets result to vec0 + vec1 * scalar
+func (result *VectorN) AddScaled(vec0, vec1 *VectorN, scalar float32) {
+	checkLen(len(*vec0), len(*vec1))
+	result.Resize(len(*vec0))
+	for i := range *result {
+		(*result)[i] = (*vec0)[i] + (*vec1)[i]*scalar
+	}
+}
+
+// JacobiPreconditioner
+
+func (result *JacobiPreconditioner) MakeFromSparse(mat *SparseMatrix) {
+	mat.Diagonal(&result.inv)
+	for i, d := range result.inv {
+		if abs(d) > g_EPSILON {
+			result.inv[i] = 1.0 / d
+		} else {
+			result.inv[i] = 1.0
+		}
+	}
+}
+
+func (p *JacobiPreconditioner) Apply(result, vec *VectorN) {
+	checkLen(len(*vec), len(p.inv))
+	result.Resize(len(*vec))
+	for i := range *result {
+		(*result)[i] = (*vec)[i] * p.inv[i]
+	}
+}
+
+// IncompleteCholesky
+
+// MakeFromSparse factors the symmetric matrix mat, reading only its lower
+// triangle.  It returns false if a pivot is not positive, which can happen
+// even for positive definite matrices; Jacobi preconditioning is the usual
+// fallback.
+func (result *IncompleteCholesky) MakeFromSparse(mat *SparseMatrix) bool {
+	l := &result.l
+	l.Rows, l.Cols = mat.Rows, mat.Cols
+	l.ColIndex = l.ColIndex[:0]
+	l.Values = l.Values[:0]
+	if cap(l.RowStart) < mat.Rows+1 {
+		l.RowStart = make([]int, mat.Rows+1)
+	}
+	l.RowStart = l.RowStart[:mat.Rows+1]
+
+	// copy the lower triangle, then factor it row by row in place
+	for row := 0; row < mat.Rows; row++ {
+		l.RowStart[row] = len(l.Values)
+		for i := mat.RowStart[row]; i < mat.RowStart[row+1] && mat.ColIndex[i] <= row; i++ {
+			l.ColIndex = append(l.ColIndex, mat.ColIndex[i])
+			l.Values = append(l.Values, mat.Values[i])
+		}
+	}
+	l.RowStart[mat.Rows] = len(l.Values)
+
+	for row := 0; row < l.Rows; row++ {
+		start, end := l.RowStart[row], l.RowStart[row+1]
+		if start == end || l.ColIndex[end-1] != row {
+			return false
+		}
+		for i := start; i < end-1; i++ {
+			col := l.ColIndex[i]
+			// subtract the dot product of the earlier parts of rows row
+			// and col, whose patterns are both sorted
+			sum := l.Values[i]
+			a, b := start, l.RowStart[col]
+			for a < i && b < l.RowStart[col+1]-1 {
+				switch {
+				case l.ColIndex[a] < l.ColIndex[b]:
+					a++
+				case l.ColIndex[a] > l.ColIndex[b]:
+					b++
+				default:
+					sum -= l.Values[a] * l.Values[b]
+					a++
+					b++
+				}
+			}
+			l.Values[i] = sum / l.Values[l.RowStart[col+1]-1]
+		}
+		d := l.Values[end-1]
+		for i := start; i < end-1; i++ {
+			d -= l.Values[i] * l.Values[i]
+		}
+		if d <= 0.0 {
+			return false
+		}
+		l.Values[end-1] = sqrt(d)
+	}
+	return true
+}
+
+func (p *IncompleteCholesky) Apply(result, vec *VectorN) {
+	l := &p.l
+	checkLen(len(*vec), l.Rows)
+	result.Resize(len(*vec))
+	copy(*result, *vec)
+	r := *result
+
+	// forward substitution with L, then back substitution with its
+	// transpose, reading L's rows as the transpose's columns
+	for row := 0; row < l.Rows; row++ {
+		end := l.RowStart[row+1] - 1
+		sum := r[row]
+		for i := l.RowStart[row]; i < end; i++ {
+			sum -= l.Values[i] * r[l.ColIndex[i]]
+		}
+		r[row] = sum / l.Values[end]
+	}
+	for row := l.Rows - 1; row >= 0; row-- {
+		end := l.RowStart[row+1] - 1
+		r[row] /= l.Values[end]
+		for i := l.RowStart[row]; i < end; i++ {
+			r[l.ColIndex[i]] -= l.Values[i] * r[row]
+		}
+	}
+}
+
+// ConjugateGradient
+
+// Solve finds x such that mat * x = b, starting from result when it
+// already has the right length and from zero otherwise.  precond may be
+// nil.  It returns the number of iterations taken and whether the
+// residual reached the tolerance.
+func (cg *ConjugateGradient) Solve(result *VectorN, mat *SparseMatrix, b *VectorN, precond Preconditioner) (int, bool) {
+	n := mat.Rows
+	checkLen(len(*b), n)
+	if len(*result) != n {
+		result.Resize(n)
+		for i := range *result {
+			(*result)[i] = 0.0
+		}
+	}
+	maxIterations := cg.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = n
+	}
+	tolerance := cg.Tolerance
+	if tolerance <= 0.0 {
+		tolerance = 1e-5
+	}
+	target := tolerance * tolerance * b.LengthSqr()
+
+	apply := func(result, vec *VectorN) {
+		if precond == nil {
+			result.Resize(len(*vec))
+			copy(*result, *vec)
+			return
+		}
+		precond.Apply(result, vec)
+	}
+
+	cg.q.MulSparse(result, mat)
+	cg.r.Sub(b, &cg.q)
+	if cg.r.LengthSqr() <= target {
+		return 0, true
+	}
+	apply(&cg.z, &cg.r)
+	cg.p.Resize(n)
+	copy(cg.p, cg.z)
+	rz := cg.r.Dot(&cg.z)
+
+	for iter := 1; iter <= maxIterations; iter++ {
+		cg.q.MulSparse(&cg.p, mat)
+		pq := cg.p.Dot(&cg.q)
+		if pq <= 0.0 {
+			// the matrix is not positive definite along p
+			return iter, false
+		}
+		alpha := rz / pq
+		result.AddScaled(result, &cg.p, alpha)
+		cg.r.AddScaled(&cg.r, &cg.q, -alpha)
+		if cg.r.LengthSqr() <= target {
+			return iter, true
+		}
+
+		apply(&cg.z, &cg.r)
+		rzNext := cg.r.Dot(&cg.z)
+		cg.p.AddScaled(&cg.z, &cg.p, rzNext/rz)
+		rz = rzNext
+	}
+	return maxIterations, false
+}
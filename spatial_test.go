@@ -0,0 +1,404 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func randomPoint(r *rand.Rand, scale float32) Point3 {
+	return Point3{(r.Float32()*2 - 1) * scale, (r.Float32()*2 - 1) * scale, (r.Float32()*2 - 1) * scale}
+}
+
+func randomBoxes(r *rand.Rand, count int) []AABB {
+	boxes := make([]AABB, count)
+	for i := range boxes {
+		center := randomPoint(r, 50)
+		size := Vector3{r.Float32() * 2, r.Float32() * 2, r.Float32() * 2}
+		boxes[i].Min.SubV3(&center, &size)
+		boxes[i].Max.AddV3(&center, &size)
+	}
+	return boxes
+}
+
+func sameItems(t *testing.T, name string, got, expected []int) {
+	sort.Ints(got)
+	sort.Ints(expected)
+	if len(got) != len(expected) {
+		t.Error(name, "found", len(got), "expected", len(expected))
+		return
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Error(name, "mismatch", got, expected)
+			return
+		}
+	}
+}
+
+func TestBVH(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	boxes := randomBoxes(r, 500)
+
+	var bvh BVH
+	bvh.Build(boxes)
+	removed := make(map[int]bool)
+
+	check := func(name string) {
+		query := &AABB{Min: Point3{-10, -10, -10}, Max: Point3{10, 10, 10}}
+		var got, expected []int
+		bvh.QueryAABB(query, func(item int) bool {
+			got = append(got, item)
+			return true
+		})
+		for i := range boxes {
+			if boxes[i].Overlaps(query) {
+				expected = append(expected, i)
+			}
+		}
+		sameItems(t, name+" aabb query", got, expected)
+
+		sphere := &Sphere{Center: Point3{5, 5, 5}, Radius: 15}
+		var cp ClosestPoints
+		got, expected = got[:0], expected[:0]
+		bvh.QuerySphere(sphere, func(item int) bool {
+			got = append(got, item)
+			return true
+		})
+		for i := range boxes {
+			if cp.PointAABB(&sphere.Center, &boxes[i]); cp.DistSqr <= sphere.Radius*sphere.Radius {
+				expected = append(expected, i)
+			}
+		}
+		sameItems(t, name+" sphere query", got, expected)
+
+		pairs := 0
+		bvh.Pairs(func(a, b int) bool {
+			if !boxes[a].Overlaps(&boxes[b]) {
+				t.Error(name, "pair doesn't overlap", a, b)
+			}
+			pairs++
+			return true
+		})
+		expectedPairs := 0
+		for i := range boxes {
+			for j := i + 1; j < len(boxes); j++ {
+				if !removed[i] && !removed[j] && boxes[i].Overlaps(&boxes[j]) {
+					expectedPairs++
+				}
+			}
+		}
+		if pairs != expectedPairs {
+			t.Error(name, "pairs", pairs, expectedPairs)
+		}
+
+		ray := &Ray{Origin: Point3{-60, 0.5, 0.5}, Direction: Vector3{1, 0.01, 0.02}}
+		ray.Direction.NormalizeSelf()
+		var hit RayHit
+		item, dist, ok := bvh.RayNearest(ray, 1000, func(item int) (float32, bool) {
+			if ray.IntersectAABB(&boxes[item], &hit) {
+				return hit.Distance, true
+			}
+			return 0, false
+		})
+		expectedItem, expectedDist := -1, float32(1000)
+		for i := range boxes {
+			if ray.IntersectAABB(&boxes[i], &hit) && hit.Distance < expectedDist {
+				expectedItem, expectedDist = i, hit.Distance
+			}
+		}
+		if ok != (expectedItem >= 0) || item != expectedItem || !nearlyEqual(dist, expectedDist) {
+			t.Error(name, "ray nearest", item, dist, expectedItem, expectedDist)
+		}
+		_, anyHit := bvh.RayAny(ray, 1000, func(item int) bool {
+			return ray.IntersectAABB(&boxes[item], &hit)
+		})
+		if anyHit != ok {
+			t.Error(name, "ray any", anyHit, ok)
+		}
+	}
+	check("built")
+
+	var dynamic BVH
+	for i := range boxes {
+		dynamic.Insert(i, &boxes[i])
+	}
+	bvh = dynamic
+	check("inserted")
+
+	for i := 0; i < len(boxes); i += 3 {
+		bvh.Remove(i)
+		removed[i] = true
+		boxes[i] = AABB{Min: Point3{1000, 1000, 1000}, Max: Point3{1001, 1001, 1001}}
+	}
+	for i := 1; i < len(boxes); i += 3 {
+		var offset Vector3
+		offset[x] = 5
+		boxes[i].Min.AddV3ToSelf(&offset)
+		boxes[i].Max.AddV3ToSelf(&offset)
+		bvh.Refit(i, &boxes[i])
+	}
+	check("removed and refit")
+	if bvh.Len() != len(boxes)-(len(boxes)+2)/3 {
+		t.Error("bvh length", bvh.Len())
+	}
+}
+
+func TestOctree(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	boxes := randomBoxes(r, 400)
+	world := &AABB{Min: Point3{-50, -50, -50}, Max: Point3{50, 50, 50}}
+
+	for _, looseness := range []float32{1, 2} {
+		var tree Octree
+		tree.MakeLoose(world, 6, 4, looseness)
+		for i := range boxes {
+			tree.Insert(i, &boxes[i])
+		}
+		removed := make(map[int]bool)
+		for i := 0; i < len(boxes); i += 4 {
+			tree.Remove(i)
+			removed[i] = true
+		}
+		for i := 1; i < len(boxes); i += 4 {
+			var offset Vector3
+			offset[y] = 3
+			boxes[i].Min.AddV3ToSelf(&offset)
+			boxes[i].Max.AddV3ToSelf(&offset)
+			tree.Move(i, &boxes[i])
+		}
+		if tree.Len() != len(boxes)-len(removed) {
+			t.Error(looseness, "octree length", tree.Len())
+		}
+
+		sphere := &Sphere{Center: Point3{-5, 10, 0}, Radius: 20}
+		var cp ClosestPoints
+		var got, expected []int
+		tree.QuerySphere(sphere, func(item int) bool {
+			got = append(got, item)
+			return true
+		})
+		for i := range boxes {
+			if cp.PointAABB(&sphere.Center, &boxes[i]); !removed[i] && cp.DistSqr <= sphere.Radius*sphere.Radius {
+				expected = append(expected, i)
+			}
+		}
+		sameItems(t, "octree sphere query", got, expected)
+
+		var proj Matrix4
+		var frustum Frustum
+		proj.MakePerspective(1.0, 1.0, 1.0, 40.0)
+		frustum.MakeFromM4(&proj, DepthNegOneToOne)
+		got, expected = got[:0], expected[:0]
+		tree.QueryFrustum(&frustum, func(item int) bool {
+			got = append(got, item)
+			return true
+		})
+		for i := range boxes {
+			if !removed[i] && frustum.TestAABB(&boxes[i]) != Outside {
+				expected = append(expected, i)
+			}
+		}
+		sameItems(t, "octree frustum query", got, expected)
+
+		pnt := Point3{3, -7, 12}
+		nearest := tree.KNearest(&pnt, 10, nil)
+		dists := make([]float32, 0, len(boxes))
+		for i := range boxes {
+			if !removed[i] {
+				cp.PointAABB(&pnt, &boxes[i])
+				dists = append(dists, cp.DistSqr)
+			}
+		}
+		sort.Slice(dists, func(i, j int) bool { return dists[i] < dists[j] })
+		if len(nearest) != 10 {
+			t.Fatal("octree k nearest found", len(nearest))
+		}
+		for i, item := range nearest {
+			if cp.PointAABB(&pnt, &boxes[item]); !nearlyEqual(cp.DistSqr, dists[i]) {
+				t.Error("octree k nearest", i, cp.DistSqr, dists[i])
+			}
+		}
+	}
+}
+
+func TestOctreeZero(t *testing.T) {
+	// a tree that was never made keeps everything in its root
+	var tree Octree
+	boxes := randomBoxes(rand.New(rand.NewSource(4)), 20)
+	for i := range boxes {
+		tree.Insert(i, &boxes[i])
+	}
+	if tree.Len() != len(boxes) {
+		t.Error("zero octree length", tree.Len())
+	}
+	var got, expected []int
+	query := &AABB{Min: Point3{-20, -20, -20}, Max: Point3{0, 20, 20}}
+	tree.QueryAABB(query, func(item int) bool {
+		got = append(got, item)
+		return true
+	})
+	for i := range boxes {
+		if query.Overlaps(&boxes[i]) {
+			expected = append(expected, i)
+		}
+	}
+	sameItems(t, "zero octree query", got, expected)
+}
+
+func TestOctreeIDs(t *testing.T) {
+	// ids are arbitrary, including negative ones
+	var tree Octree
+	tree.Make(&AABB{Min: Point3{-10, -10, -10}, Max: Point3{10, 10, 10}}, 4, 1)
+	ids := []int{-1, math.MinInt32, 7, -42}
+	for i, id := range ids {
+		tree.InsertPoint(id, &Point3{float32(i), 0, 0})
+	}
+	nearest := tree.KNearest(&Point3{-1, 0, 0}, 3, nil)
+	if len(nearest) != 3 || nearest[0] != -1 || nearest[1] != math.MinInt32 || nearest[2] != 7 {
+		t.Error("octree k nearest with negative ids", nearest)
+	}
+	if !tree.Remove(-1) || tree.Remove(-1) || tree.Len() != 3 {
+		t.Error("octree remove negative id", tree.Len())
+	}
+	nearest = tree.KNearest(&Point3{-1, 0, 0}, 1, nearest)
+	if len(nearest) != 1 || nearest[0] != math.MinInt32 {
+		t.Error("octree k nearest after remove", nearest)
+	}
+}
+
+func TestKDTree(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	pnts := make([]Point3, 2000)
+	for i := range pnts {
+		pnts[i] = randomPoint(r, 10)
+	}
+	// duplicates mustn't upset the median split
+	for i := 0; i < 50; i++ {
+		pnts[i*3] = pnts[0]
+	}
+
+	var tree KDTree
+	tree.Build(pnts)
+	for q := 0; q < 50; q++ {
+		pnt := randomPoint(r, 12)
+		order := make([]int, len(pnts))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool { return pnt.DistSqr(&pnts[order[i]]) < pnt.DistSqr(&pnts[order[j]]) })
+
+		nearest, distSqr := tree.Nearest(&pnt)
+		if !nearlyEqual(distSqr, pnt.DistSqr(&pnts[order[0]])) || distSqr != pnt.DistSqr(&pnts[nearest]) {
+			t.Error("kd nearest", nearest, order[0])
+		}
+
+		knn := tree.KNearest(&pnt, 12, nil)
+		if len(knn) != 12 {
+			t.Fatal("kd k nearest found", len(knn))
+		}
+		for i := range knn {
+			if !nearlyEqual(pnt.DistSqr(&pnts[knn[i]]), pnt.DistSqr(&pnts[order[i]])) {
+				t.Error("kd k nearest", i, knn[i], order[i])
+			}
+		}
+
+		const eps = 0.5
+		approx := tree.KNearestApprox(&pnt, 5, eps, nil)
+		for i := range approx {
+			if pnt.Dist(&pnts[approx[i]]) > (1+eps)*pnt.Dist(&pnts[order[i]])+1e-5 {
+				t.Error("kd approximate k nearest", i, approx[i], order[i])
+			}
+		}
+
+		var expected []int
+		for i := range pnts {
+			if pnt.DistSqr(&pnts[i]) <= 4 {
+				expected = append(expected, i)
+			}
+		}
+		sameItems(t, "kd radius", tree.Radius(&pnt, 2, nil), expected)
+	}
+
+	var empty KDTree
+	empty.Build(nil)
+	if i, _ := empty.Nearest(&Point3{}); i != -1 {
+		t.Error("kd nearest in empty tree", i)
+	}
+}
+
+func TestSpatialHash(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	pnts := make([]Point3, 1000)
+	for i := range pnts {
+		pnts[i] = randomPoint(r, 20)
+	}
+
+	var hash SpatialHash
+	hash.Build(pnts, 1.5)
+	const radius = 2.0
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			var got []int
+			for q := 0; q < 25; q++ {
+				pnt := randomPoint(r, 22)
+				got = hash.Neighbours(&pnt, radius, got)
+				var expected []int
+				for i := range pnts {
+					if pnt.DistSqr(&pnts[i]) <= radius*radius {
+						expected = append(expected, i)
+					}
+				}
+				sameItems(t, "hash neighbours", got, expected)
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	pairs := 0
+	hash.Pairs(radius, func(a, b int) bool {
+		if a >= b || pnts[a].DistSqr(&pnts[b]) > radius*radius {
+			t.Error("hash bad pair", a, b)
+		}
+		pairs++
+		return true
+	})
+	expectedPairs := 0
+	for i := range pnts {
+		for j := i + 1; j < len(pnts); j++ {
+			if pnts[i].DistSqr(&pnts[j]) <= radius*radius {
+				expectedPairs++
+			}
+		}
+	}
+	if pairs != expectedPairs {
+		t.Error("hash pairs", pairs, expectedPairs)
+	}
+
+	// a query covering more cells than there are points
+	origin := Point3{}
+	if got := hash.Neighbours(&origin, 100, nil); len(got) != len(pnts) {
+		t.Error("hash huge query", len(got))
+	}
+
+	// cells past the int32 range are clamped rather than wrapping
+	far := []Point3{{1e12, 0, 0}, {1e12, 0.5, 0}, {-1e12, 0, 0}, {2147483520, 0, 0}}
+	hash.Build(far, 1)
+	if got := hash.Neighbours(&far[0], 1, nil); len(got) != 2 {
+		t.Error("hash far neighbours", got)
+	}
+	if got := hash.Neighbours(&far[3], 200, nil); len(got) != 1 {
+		t.Error("hash neighbours at the edge of the cell range", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+)
+
+// SpatialHash buckets points into a uniform grid of cubic cells, hashing
+// the integer cell coordinates into a table sized to the point count so
+// that unbounded worlds need no preallocated grid.  Queries return indices
+// into the slice passed to Build, which must not be modified while the
+// hash is in use.  Queries don't modify the hash, so any number of
+// goroutines may run them concurrently between builds.
+type SpatialHash struct {
+	pnts      []Point3
+	cellSize  float32
+	invCell   float32
+	cellStart []int
+	entries   []int
+}
+
+// Cell returns the integer coordinates of the cell holding pnt.  Cells
+// beyond the range of an int32 are clamped to it.
+func (h *SpatialHash) Cell(pnt *Point3) [3]int32 {
+	return [3]int32{
+		cellCoord(pnt[x] * h.invCell),
+		cellCoord(pnt[y] * h.invCell),
+		cellCoord(pnt[z] * h.invCell),
+	}
+}
+
+func cellCoord(f float32) int32 {
+	f = floor(f)
+	switch {
+	case f <= math.MinInt32:
+		return math.MinInt32
+	case f >= math.MaxInt32:
+		return math.MaxInt32
+	}
+	return int32(f)
+}
+
+func (h *SpatialHash) hash(cell [3]int32) int {
+	hash := uint32(cell[x])*73856093 ^ uint32(cell[y])*19349663 ^ uint32(cell[z])*83492791
+	return int(hash % uint32(len(h.cellStart)-1))
+}
+
+// Build rehashes all of pnts with the given cell size.  A cell size close
+// to the typical query radius works best.
+func (result *SpatialHash) Build(pnts []Point3, cellSize float32) {
+	result.pnts = pnts
+	result.cellSize = cellSize
+	result.invCell = 1.0 / cellSize
+
+	tableSize := 2*len(pnts) + 1
+	if cap(result.cellStart) < tableSize+1 {
+		result.cellStart = make([]int, tableSize+1)
+	}
+	result.cellStart = result.cellStart[:tableSize+1]
+	if cap(result.entries) < len(pnts) {
+		result.entries = make([]int, len(pnts))
+	}
+	result.entries = result.entries[:len(pnts)]
+
+	// counting sort by bucket: count, prefix sum, then fill backwards
+	for i := range result.cellStart {
+		result.cellStart[i] = 0
+	}
+	for i := range pnts {
+		result.cellStart[result.hash(result.Cell(&pnts[i]))]++
+	}
+	start := 0
+	for i := range result.cellStart {
+		start += result.cellStart[i]
+		result.cellStart[i] = start
+	}
+	for i := range pnts {
+		bucket := result.hash(result.Cell(&pnts[i]))
+		result.cellStart[bucket]--
+		result.entries[result.cellStart[bucket]] = i
+	}
+}
+
+func (h *SpatialHash) Len() int {
+	return len(h.entries)
+}
+
+func (h *SpatialHash) CellSize() float32 {
+	return h.cellSize
+}
+
+// query calls fn for every point within radius of pnt.  Buckets shared by
+// several cells are filtered by cell so no point is visited twice.  When
+// the query covers more cells than there are points, the points are
+// simply tested one by one.
+func (h *SpatialHash) query(pnt *Point3, radius float32, fn func(i int) bool) bool {
+	if len(h.entries) == 0 {
+		return true
+	}
+	var lo, hi Point3
+	offset := Vector3{radius, radius, radius}
+	lo.SubV3(pnt, &offset)
+	hi.AddV3(pnt, &offset)
+	minCell := h.Cell(&lo)
+	maxCell := h.Cell(&hi)
+	radiusSqr := radius * radius
+
+	cells := float32(1.0)
+	for i := 0; i < 3; i++ {
+		cells *= float32(int64(maxCell[i]) - int64(minCell[i]) + 1)
+	}
+	if cells > float32(len(h.entries)) {
+		for i := range h.pnts {
+			if pnt.DistSqr(&h.pnts[i]) <= radiusSqr && !fn(i) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// count in int64 so a range ending at the largest cell terminates
+	var cell [3]int32
+	for cx := int64(minCell[x]); cx <= int64(maxCell[x]); cx++ {
+		cell[x] = int32(cx)
+		for cy := int64(minCell[y]); cy <= int64(maxCell[y]); cy++ {
+			cell[y] = int32(cy)
+			for cz := int64(minCell[z]); cz <= int64(maxCell[z]); cz++ {
+				cell[z] = int32(cz)
+				bucket := h.hash(cell)
+				for _, i := range h.entries[h.cellStart[bucket]:h.cellStart[bucket+1]] {
+					if h.Cell(&h.pnts[i]) != cell || pnt.DistSqr(&h.pnts[i]) > radiusSqr {
+						continue
+					}
+					if !fn(i) {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Neighbours appends to result the indices of all points within radius of
+// pnt, in no particular order
+func (h *SpatialHash) Neighbours(pnt *Point3, radius float32, result []int) []int {
+	result = result[:0]
+	h.query(pnt, radius, func(i int) bool {
+		result = append(result, i)
+		return true
+	})
+	return result
+}
+
+// Pairs calls fn once for every pair of points no further than radius
+// apart, with a < b, until fn returns false
+func (h *SpatialHash) Pairs(radius float32, fn func(a, b int) bool) {
+	for a := range h.pnts {
+		more := h.query(&h.pnts[a], radius, func(b int) bool {
+			if b <= a {
+				return true
+			}
+			return fn(a, b)
+		})
+		if !more {
+			return
+		}
+	}
+}
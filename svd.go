@@ -0,0 +1,230 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// SVD decomposes m into u * diag(sigma) * transpose(v), where u and v are
+// both proper rotations.  The singular values are sorted by decreasing
+// magnitude.  Keeping u and v free of reflections means that when m
+// itself reflects, with a negative determinant, the last singular value
+// is negative.
+func (m *Matrix3) SVD(u *Matrix3, sigma *Vector3, v *Matrix3) {
+	// one sided Jacobi leaves m * v = u * sigma in b without ever forming
+	// mT * m, so small singular values keep their relative accuracy
+	b := *m
+	jacobiSVD(b[:], v[:], 3)
+
+	// sort by column length, carrying the columns of v along
+	var norms Vector3
+	for i := 0; i < 3; i++ {
+		norms[i] = sqrt(b[i*3]*b[i*3] + b[i*3+1]*b[i*3+1] + b[i*3+2]*b[i*3+2])
+	}
+	order := [3]int{0, 1, 2}
+	for i := 1; i < 3; i++ {
+		for j := i; j > 0 && norms[order[j]] > norms[order[j-1]]; j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+	var b0, b1, b2, v0, v1, v2, check Vector3
+	b.Col(&b0, order[0])
+	b.Col(&b1, order[1])
+	b.Col(&b2, order[2])
+	v.Col(&v0, order[0])
+	v.Col(&v1, order[1])
+	v.Col(&v2, order[2])
+
+	// reordering may have left v reflecting
+	check.Cross(&v0, &v1)
+	if check.Dot(&v2) < 0.0 {
+		v2.NegSelf()
+		b2.NegSelf()
+	}
+	v.MakeFromCols(&v0, &v1, &v2)
+
+	// the columns of b give u once normalized.  Columns lost to rank
+	// deficiency are filled in perpendicular to the ones before.
+	var col0, col1, col2, along Vector3
+	sigma[x] = norms[order[0]]
+	if sigma[x] > g_EPSILON {
+		col0.ScalarMul(&b0, 1.0/sigma[x])
+	} else {
+		col0 = Vector3{1, 0, 0}
+	}
+
+	along.ScalarMul(&col0, b1.Dot(&col0))
+	col1.Sub(&b1, &along)
+	if col1.Length() > g_EPSILON*(sigma[x]+1.0) {
+		col1.NormalizeSelf()
+	} else {
+		perpendicular(&col1, &col0)
+	}
+	sigma[y] = b1.Dot(&col1)
+
+	col2.Cross(&col0, &col1)
+	sigma[z] = b2.Dot(&col2)
+	u.MakeFromCols(&col0, &col1, &col2)
+}
+
+// jacobiSVD orthogonalizes the columns of the n by n column major matrix a
+// in place with one sided Jacobi rotations, accumulating them into v.
+// Afterwards a holds u * sigma, so the column lengths are the singular
+// values.
+func jacobiSVD(a, v []float32, n int) {
+	for i := range v {
+		v[i] = 0.0
+	}
+	for i := 0; i < n; i++ {
+		v[i*n+i] = 1.0
+	}
+
+	for sweep := 0; sweep < jacobiMaxSweeps; sweep++ {
+		rotated := false
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				alpha, beta, gamma := float32(0.0), float32(0.0), float32(0.0)
+				for k := 0; k < n; k++ {
+					alpha += a[p*n+k] * a[p*n+k]
+					beta += a[q*n+k] * a[q*n+k]
+					gamma += a[p*n+k] * a[q*n+k]
+				}
+				if abs(gamma) <= g_EPSILON*sqrt(alpha*beta) || gamma == 0.0 {
+					continue
+				}
+				rotated = true
+
+				zeta := (beta - alpha) / (2.0 * gamma)
+				t := 1.0 / (abs(zeta) + sqrt(zeta*zeta+1.0))
+				if zeta < 0.0 {
+					t = -t
+				}
+				c := 1.0 / sqrt(t*t+1.0)
+				s := t * c
+				for k := 0; k < n; k++ {
+					akp, akq := a[p*n+k], a[q*n+k]
+					a[p*n+k] = c*akp - s*akq
+					a[q*n+k] = s*akp + c*akq
+					vkp, vkq := v[p*n+k], v[q*n+k]
+					v[p*n+k] = c*vkp - s*vkq
+					v[q*n+k] = s*vkp + c*vkq
+				}
+			}
+		}
+		if !rotated {
+			return
+		}
+	}
+}
+
+// Polar splits m into rot * stretch, where rot is the proper rotation
+// closest to m and stretch is symmetric.  A reflection in m is left in
+// stretch rather than rot.
+func (m *Matrix3) Polar(rot, stretch *Matrix3) {
+	var u, v, vt Matrix3
+	var sigma Vector3
+	m.SVD(&u, &sigma, &v)
+	vt.Transpose(&v)
+	rot.Mul(&u, &vt)
+	if stretch != nil {
+		var scaled Matrix3
+		scaled.AppendScale(&v, &sigma)
+		stretch.Mul(&scaled, &vt)
+	}
+}
+
+// PolarQ is Polar with the rotation as a quaternion.  stretch may be nil.
+func (m *Matrix3) PolarQ(rot *Quaternion, stretch *Matrix3) {
+	var rotM Matrix3
+	m.Polar(&rotM, stretch)
+	rot.MakeFromM3(&rotM)
+	rot.NormalizeSelf()
+}
+
+// NearestRotation returns the rotation closest to mat, removing any scale,
+// shear or drift.  Unlike Gram-Schmidt it favours no axis.
+func (result *Matrix3) NearestRotation(mat *Matrix3) {
+	mat.Polar(result, nil)
+}
+
+func (result *Matrix3) NearestRotationSelf() {
+	result.NearestRotation(result)
+}
+
+// NearestRotation replaces the upper 3x3 of tfrm with its nearest rotation,
+// keeping the translation
+func (result *Transform3) NearestRotation(tfrm *Transform3) {
+	var upper Matrix3
+	tfrm.Upper3x3(&upper)
+	upper.NearestRotationSelf()
+	*result = *tfrm
+	result.SetUpper3x3(&upper)
+}
+
+func (result *Transform3) NearestRotationSelf() {
+	result.NearestRotation(result)
+}
+
+// PseudoInverse returns the Moore-Penrose pseudo-inverse of mat, which
+// solves singular and inconsistent systems in the least squares sense.
+// Singular values smaller than cutoff times the largest are treated as
+// zero; around 1e-5 suits float32 data.
+func (result *Matrix3) PseudoInverse(mat *Matrix3, cutoff float32) {
+	var u, v Matrix3
+	var sigma Vector3
+	mat.SVD(&u, &sigma, &v)
+
+	// v * inverse(sigma) * transpose(u), skipping the negligible values
+	*result = Matrix3{}
+	for i := 0; i < 3; i++ {
+		if abs(sigma[i]) <= cutoff*abs(sigma[x]) || sigma[i] == 0.0 {
+			continue
+		}
+		inv := 1.0 / sigma[i]
+		for col := 0; col < 3; col++ {
+			for row := 0; row < 3; row++ {
+				result[col*3+row] += v[i*3+row] * u[i*3+col] * inv
+			}
+		}
+	}
+}
+
+func (result *Matrix3) PseudoInverseSelf(cutoff float32) {
+	result.PseudoInverse(result, cutoff)
+}
+
+// PseudoInverse returns the Moore-Penrose pseudo-inverse of mat.  Singular
+// values smaller than cutoff times the largest are treated as zero.
+func (result *Matrix4) PseudoInverse(mat *Matrix4, cutoff float32) {
+	// one sided Jacobi leaves b = u * sigma, and the pseudo-inverse is the
+	// sum of v_i * transpose(b_i) / sigma_i^2
+	var b, v Matrix4
+	b = *mat
+	jacobiSVD(b[:], v[:], 4)
+
+	var sigma [4]float32
+	largest := float32(0.0)
+	for i := range sigma {
+		for row := 0; row < 4; row++ {
+			sigma[i] += b[i*4+row] * b[i*4+row]
+		}
+		sigma[i] = sqrt(sigma[i])
+		largest = max(largest, sigma[i])
+	}
+
+	*result = Matrix4{}
+	for i := range sigma {
+		if sigma[i] <= cutoff*largest || sigma[i] == 0.0 {
+			continue
+		}
+		inv := 1.0 / (sigma[i] * sigma[i])
+		for col := 0; col < 4; col++ {
+			for row := 0; row < 4; row++ {
+				result[col*4+row] += v[i*4+row] * b[i*4+col] * inv
+			}
+		}
+	}
+}
+
+func (result *Matrix4) PseudoInverseSelf(cutoff float32) {
+	result.PseudoInverse(result, cutoff)
+}
@@ -0,0 +1,512 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"math"
+)
+
+// SweepHit describes the first contact of a moving shape.  Time is when
+// contact begins, in the units of the velocities given, and is zero for
+// shapes already touching.  Normal is the unit normal of the obstacle at
+// the contact, pointing toward the moving shape, and Point is where they
+// touch at that time.
+type SweepHit struct {
+	Time   float32
+	Normal Vector3
+	Point  Point3
+}
+
+// Motion is a rigid body's pose at time zero along with constant linear
+// and angular velocities.  AngularVelocity is the rotation axis scaled by
+// the rate of rotation in radians.
+type Motion struct {
+	Position        Point3
+	Rotation        Quaternion
+	LinearVelocity  Vector3
+	AngularVelocity Vector3
+}
+
+const (
+	caMaxIterations = 64
+	caTolerance     = 1e-3
+)
+
+func (m *Motion) Transform(result *Transform3, t float32) {
+	var pos Point3
+	var offset Vector3
+	var rot Quaternion
+	offset.ScalarMul(&m.LinearVelocity, t)
+	pos.AddV3(&m.Position, &offset)
+
+	rot = m.Rotation
+	if rate := m.AngularVelocity.Length(); rate*t > g_EPSILON {
+		var axis Vector3
+		var spin Quaternion
+		axis.ScalarMul(&m.AngularVelocity, 1.0/rate)
+		spin.MakeRotationAxis(rate*t, &axis)
+		rot.Mul(&spin, &m.Rotation)
+		rot.NormalizeSelf()
+	}
+
+	offset.MakeFromP3(&pos)
+	result.MakeFromQV3(&rot, &offset)
+}
+
+// setNormal points the hit normal from closest toward center, falling back
+// to against the relative velocity when they coincide
+func (result *SweepHit) setNormal(center, closest *Point3, vel *Vector3) {
+	result.Normal.P3Sub(center, closest)
+	if result.Normal.LengthSqr() < g_EPSILON*g_EPSILON {
+		result.Normal.Neg(vel)
+	}
+	if result.Normal.LengthSqr() > 0.0 {
+		result.Normal.NormalizeSelf()
+	}
+}
+
+// sweepPlane finds when a shape whose extent along the plane normal is
+// radius first touches the plane, approaching from either side
+func (result *SweepHit) sweepPlane(center *Point3, radius float32, vel *Vector3, plane *Plane, maxTime float32) bool {
+	var normal Vector3
+	plane.Normal(&normal)
+	dist := plane.Dist(center)
+	if dist < 0.0 {
+		normal.NegSelf()
+		dist = -dist
+	}
+	result.Normal = normal
+	if dist <= radius {
+		result.Time = 0.0
+		return true
+	}
+	approach := -normal.Dot(vel)
+	if approach <= 0.0 {
+		return false
+	}
+	t := (dist - radius) / approach
+	if t > maxTime {
+		return false
+	}
+	result.Time = t
+	return true
+}
+
+func (result *SweepHit) SpherePlane(sphere *Sphere, vel *Vector3, plane *Plane, maxTime float32) bool {
+	if !result.sweepPlane(&sphere.Center, sphere.Radius, vel, plane, maxTime) {
+		return false
+	}
+	var offset Vector3
+	offset.ScalarMul(vel, result.Time)
+	result.Point.AddV3(&sphere.Center, &offset)
+	plane.ClosestPoint(&result.Point, &result.Point)
+	return true
+}
+
+// SphereTriangle tests the sphere's center as a ray against the triangle
+// grown by the radius: the face pushed out along its normal and a capsule
+// around each edge
+func (result *SweepHit) SphereTriangle(sphere *Sphere, vel *Vector3, tri *Triangle, maxTime float32) bool {
+	var closest Point3
+	tri.ClosestPoint(&closest, &sphere.Center)
+	if closest.DistSqr(&sphere.Center) <= sphere.Radius*sphere.Radius {
+		result.Time = 0.0
+		result.Point = closest
+		result.setNormal(&sphere.Center, &closest, vel)
+		return true
+	}
+
+	var plane Plane
+	var face SweepHit
+	best := float32(math.MaxFloat32)
+	tri.Plane(&plane)
+	if face.sweepPlane(&sphere.Center, sphere.Radius, vel, &plane, maxTime) {
+		var contact Point3
+		var offset Vector3
+		offset.ScalarMul(vel, face.Time)
+		contact.AddV3(&sphere.Center, &offset)
+		offset.ScalarMul(&face.Normal, sphere.Radius)
+		contact.SubV3FromSelf(&offset)
+		if tri.ContainsPoint(&contact) {
+			best = face.Time
+		}
+	}
+
+	var hit RayHit
+	ray := Ray{Origin: sphere.Center, Direction: *vel}
+	for i := 0; i < 3; i++ {
+		if ray.IntersectCapsule(&tri[i], &tri[(i+1)%3], sphere.Radius, &hit) && hit.Distance < best {
+			best = hit.Distance
+		}
+	}
+	if best > maxTime {
+		return false
+	}
+
+	var center Point3
+	result.Time = best
+	ray.PointAt(&center, best)
+	tri.ClosestPoint(&result.Point, &center)
+	result.setNormal(&center, &result.Point, vel)
+	return true
+}
+
+// SphereAABB sweeps a moving sphere against a moving box.  Relative to the
+// box the sphere's center is a ray against the box grown by the radius,
+// which is the union of the box stretched along each axis and a capsule
+// around each edge.
+func (result *SweepHit) SphereAABB(sphere *Sphere, velSphere *Vector3, box *AABB, velBox *Vector3, maxTime float32) bool {
+	var cp ClosestPoints
+	var vel Vector3
+	vel.Sub(velSphere, velBox)
+	cp.PointAABB(&sphere.Center, box)
+	if cp.DistSqr <= sphere.Radius*sphere.Radius {
+		result.Time = 0.0
+		result.Point = cp.PointB
+		result.setNormal(&sphere.Center, &cp.PointB, &vel)
+		return true
+	}
+
+	var hit RayHit
+	ray := Ray{Origin: sphere.Center, Direction: vel}
+	best := float32(math.MaxFloat32)
+	for i := 0; i < 3; i++ {
+		grown := *box
+		grown.Min[i] -= sphere.Radius
+		grown.Max[i] += sphere.Radius
+		if ray.IntersectAABB(&grown, &hit) && hit.Distance < best {
+			best = hit.Distance
+		}
+	}
+	var corners [8]Point3
+	for i := range corners {
+		for j := 0; j < 3; j++ {
+			if i&(1<<uint(j)) != 0 {
+				corners[i][j] = box.Max[j]
+			} else {
+				corners[i][j] = box.Min[j]
+			}
+		}
+	}
+	for i := range corners {
+		for j := 0; j < 3; j++ {
+			if i&(1<<uint(j)) != 0 {
+				continue
+			}
+			other := i | 1<<uint(j)
+			if ray.IntersectCapsule(&corners[i], &corners[other], sphere.Radius, &hit) && hit.Distance < best {
+				best = hit.Distance
+			}
+		}
+	}
+	if best > maxTime {
+		return false
+	}
+
+	var center Point3
+	result.Time = best
+	ray.PointAt(&center, best)
+	cp.PointAABB(&center, box)
+	result.setNormal(&center, &cp.PointB, &vel)
+	var offset Vector3
+	offset.ScalarMul(velBox, best)
+	result.Point.AddV3(&cp.PointB, &offset)
+	return true
+}
+
+// SphereSphere sweeps sphere a against sphere b, both moving.  The normal
+// is that of b.
+func (result *SweepHit) SphereSphere(a *Sphere, velA *Vector3, b *Sphere, velB *Vector3, maxTime float32) bool {
+	var vel, offset Vector3
+	var centerA, centerB Point3
+	vel.Sub(velA, velB)
+	radius := a.Radius + b.Radius
+	if a.Center.DistSqr(&b.Center) <= radius*radius {
+		result.Time = 0.0
+	} else {
+		var hit RayHit
+		ray := Ray{Origin: a.Center, Direction: vel}
+		if !ray.IntersectSphere(&Sphere{Center: b.Center, Radius: radius}, &hit) || hit.Distance > maxTime {
+			return false
+		}
+		result.Time = hit.Distance
+	}
+
+	offset.ScalarMul(velA, result.Time)
+	centerA.AddV3(&a.Center, &offset)
+	offset.ScalarMul(velB, result.Time)
+	centerB.AddV3(&b.Center, &offset)
+	result.setNormal(&centerA, &centerB, &vel)
+	offset.ScalarMul(&result.Normal, b.Radius)
+	result.Point.AddV3(&centerB, &offset)
+	return true
+}
+
+func (result *SweepHit) AABBPlane(box *AABB, vel *Vector3, plane *Plane, maxTime float32) bool {
+	var center Point3
+	var extent, normal Vector3
+	box.Center(&center)
+	box.HalfExtents(&extent)
+	plane.Normal(&normal)
+	radius := extent[x]*abs(normal[x]) + extent[y]*abs(normal[y]) + extent[z]*abs(normal[z])
+	if !result.sweepPlane(&center, radius, vel, plane, maxTime) {
+		return false
+	}
+
+	// the corner leading toward the plane
+	var offset Vector3
+	offset.ScalarMul(vel, result.Time)
+	result.Point.AddV3(&center, &offset)
+	for i := 0; i < 3; i++ {
+		if result.Normal[i] > 0.0 {
+			result.Point[i] -= extent[i]
+		} else if result.Normal[i] < 0.0 {
+			result.Point[i] += extent[i]
+		}
+	}
+	return true
+}
+
+// sweepSAT tracks the separating axis test for a moving shape A against a
+// static shape B: contact lasts from first to last, and normal is the axis
+// that separated them longest
+type sweepSAT struct {
+	first, last float32
+	normal      Vector3
+}
+
+func (s *sweepSAT) init() {
+	s.first = float32(-math.MaxFloat32)
+	s.last = float32(math.MaxFloat32)
+	s.normal = Vector3{}
+}
+
+// axis narrows the contact interval by the projections of A and B onto
+// axis, with A moving at vel along it.  It returns false if the shapes
+// can never overlap.
+func (s *sweepSAT) axis(axis *Vector3, minA, maxA, minB, maxB, vel float32) bool {
+	var enter, exit float32
+	switch {
+	case vel > 0.0:
+		enter = (minB - maxA) / vel
+		exit = (maxB - minA) / vel
+	case vel < 0.0:
+		enter = (maxB - minA) / vel
+		exit = (minB - maxA) / vel
+	default:
+		return maxA >= minB && minA <= maxB
+	}
+	if enter > s.first {
+		s.first = enter
+		if vel > 0.0 {
+			s.normal.Neg(axis)
+		} else {
+			s.normal = *axis
+		}
+	}
+	s.last = min(s.last, exit)
+	return s.first <= s.last
+}
+
+func (s *sweepSAT) finish(result *SweepHit, maxTime float32) bool {
+	if s.first > maxTime || s.last < 0.0 {
+		return false
+	}
+	result.Time = max(s.first, 0.0)
+	result.Normal = s.normal
+	if result.Normal.LengthSqr() > 0.0 {
+		result.Normal.NormalizeSelf()
+	}
+	return true
+}
+
+// AABBAABB sweeps box a against box b, both moving
+func (result *SweepHit) AABBAABB(a *AABB, velA *Vector3, b *AABB, velB *Vector3, maxTime float32) bool {
+	var sat sweepSAT
+	var vel Vector3
+	vel.Sub(velA, velB)
+	sat.init()
+	for i := 0; i < 3; i++ {
+		var axis Vector3
+		axis[i] = 1.0
+		if !sat.axis(&axis, a.Min[i], a.Max[i], b.Min[i], b.Max[i], vel[i]) {
+			return false
+		}
+	}
+	if !sat.finish(result, maxTime) {
+		return false
+	}
+
+	// the middle of the region where the boxes meet
+	var movedA, movedB AABB
+	var offset Vector3
+	offset.ScalarMul(velA, result.Time)
+	movedA.Min.AddV3(&a.Min, &offset)
+	movedA.Max.AddV3(&a.Max, &offset)
+	offset.ScalarMul(velB, result.Time)
+	movedB.Min.AddV3(&b.Min, &offset)
+	movedB.Max.AddV3(&b.Max, &offset)
+	movedA.Min.MaxPerElemSelf(&movedB.Min)
+	movedA.Max.MinPerElemSelf(&movedB.Max)
+	movedA.Center(&result.Point)
+	return true
+}
+
+// AABBTriangle sweeps a box against a triangle over the same thirteen
+// axes as Triangle.OverlapsAABB
+func (result *SweepHit) AABBTriangle(box *AABB, vel *Vector3, tri *Triangle, maxTime float32) bool {
+	var center Point3
+	var extent Vector3
+	var edges [3]Vector3
+	box.Center(&center)
+	box.HalfExtents(&extent)
+	for i := 0; i < 3; i++ {
+		edges[i].P3Sub(&tri[(i+1)%3], &tri[i])
+	}
+
+	axes := make([]Vector3, 0, 13)
+	axes = append(axes, Vector3{1, 0, 0}, Vector3{0, 1, 0}, Vector3{0, 0, 1})
+	var normal Vector3
+	normal.Cross(&edges[0], &edges[1])
+	axes = append(axes, normal)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var cross Vector3
+			cross.Cross(&axes[j], &edges[i])
+			axes = append(axes, cross)
+		}
+	}
+
+	var sat sweepSAT
+	sat.init()
+	for i := range axes {
+		axis := &axes[i]
+		if axis.LengthSqr() < g_EPSILON*g_EPSILON {
+			continue
+		}
+		axis.NormalizeSelf()
+		c := center.Projection(axis)
+		r := extent[x]*abs(axis[x]) + extent[y]*abs(axis[y]) + extent[z]*abs(axis[z])
+		p0 := tri[0].Projection(axis)
+		p1 := tri[1].Projection(axis)
+		p2 := tri[2].Projection(axis)
+		if !sat.axis(axis, c-r, c+r, min(p0, min(p1, p2)), max(p0, max(p1, p2)), vel.Dot(axis)) {
+			return false
+		}
+	}
+	if !sat.finish(result, maxTime) {
+		return false
+	}
+
+	// settle on a point of the triangle touching the moved box
+	var moved AABB
+	var offset Vector3
+	var cp ClosestPoints
+	offset.ScalarMul(vel, result.Time)
+	moved.Min.AddV3(&box.Min, &offset)
+	moved.Max.AddV3(&box.Max, &offset)
+	moved.Center(&center)
+	tri.ClosestPoint(&result.Point, &center)
+	cp.PointAABB(&result.Point, &moved)
+	tri.ClosestPoint(&result.Point, &cp.PointB)
+	return true
+}
+
+// supportRadius bounds the distance of a shape's points from its local
+// origin by the furthest corner of the box given by its support points
+func supportRadius(shape Support) float32 {
+	var corner Vector3
+	for i := 0; i < 3; i++ {
+		var dir Vector3
+		dir[i] = 1.0
+		hi := shape.Support(&dir)
+		dir[i] = -1.0
+		lo := shape.Support(&dir)
+		corner[i] = max(abs(hi[i]), abs(lo[i]))
+	}
+	return corner.Length()
+}
+
+// ConservativeAdvancement finds when two convex shapes, given in their
+// local space and moving rigidly, first come within a small tolerance of
+// each other.  Each step advances time by the current distance divided by
+// a bound on how fast any points of the shapes can approach, so contact is
+// never stepped over.  The normal is that of b.  It returns false if the
+// shapes don't get that close within maxTime or the iteration limit.
+func (result *SweepHit) ConservativeAdvancement(shapeA Support, motionA *Motion, shapeB Support, motionB *Motion, maxTime float32) bool {
+	radiusA := supportRadius(shapeA)
+	radiusB := supportRadius(shapeB)
+	angular := motionA.AngularVelocity.Length()*radiusA + motionB.AngularVelocity.Length()*radiusB
+	tolerance := caTolerance * max(radiusA+radiusB, 1.0)
+
+	var vel Vector3
+	vel.Sub(&motionA.LinearVelocity, &motionB.LinearVelocity)
+
+	a := TransformedSupport{Shape: shapeA}
+	b := TransformedSupport{Shape: shapeB}
+	motionA.Transform(&a.Transform, 0.0)
+	motionB.Transform(&b.Transform, 0.0)
+
+	var contact Contact
+	if contact.EPA(&a, &b) {
+		// already overlapping, report the deepest point of b
+		result.Time = 0.0
+		result.Normal.Neg(&contact.Normal)
+		if result.Normal.LengthSqr() == 0.0 {
+			// only touching, EPA has no normal
+			result.Normal.Neg(&vel)
+		}
+		if result.Normal.LengthSqr() > 0.0 {
+			result.Normal.NormalizeSelf()
+		}
+		result.Point = contact.PointB
+		return true
+	}
+
+	var cp, last ClosestPoints
+	t, lastT := float32(0.0), float32(0.0)
+	converged := false
+	for iter := 0; iter < caMaxIterations; iter++ {
+		motionA.Transform(&a.Transform, t)
+		motionB.Transform(&b.Transform, t)
+		if cp.GJK(&a, &b) {
+			// rounding stepped just past contact, report the last
+			// separated time along with its closest points
+			t = lastT
+			converged = true
+			break
+		}
+		last, lastT = cp, t
+
+		dist := sqrt(cp.DistSqr)
+		if dist < tolerance {
+			converged = true
+			break
+		}
+		var dir Vector3
+		dir.P3Sub(&cp.PointB, &cp.PointA)
+		dir.ScalarMulSelf(1.0 / dist)
+
+		closing := vel.Dot(&dir) + angular
+		if closing <= 0.0 {
+			return false
+		}
+		t += dist / closing
+		if t > maxTime {
+			return false
+		}
+	}
+	if !converged {
+		return false
+	}
+
+	result.Time = t
+	result.Normal.P3Sub(&last.PointA, &last.PointB)
+	if result.Normal.LengthSqr() > 0.0 {
+		result.Normal.NormalizeSelf()
+	}
+	result.Point = last.PointB
+	return true
+}
@@ -0,0 +1,147 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+// Triangle is wound counter-clockwise when seen from the side its normal
+// faces
+type Triangle [3]Point3
+
+func (t *Triangle) edges(edge0, edge1 *Vector3) {
+	edge0.P3Sub(&t[1], &t[0])
+	edge1.P3Sub(&t[2], &t[0])
+}
+
+// Normal returns the unit face normal
+func (t *Triangle) Normal(result *Vector3) {
+	var edge0, edge1 Vector3
+	t.edges(&edge0, &edge1)
+	result.Cross(&edge0, &edge1)
+	result.NormalizeSelf()
+}
+
+func (t *Triangle) Area() float32 {
+	var edge0, edge1, cross Vector3
+	t.edges(&edge0, &edge1)
+	cross.Cross(&edge0, &edge1)
+	return 0.5 * cross.Length()
+}
+
+func (t *Triangle) Centroid(result *Point3) {
+	for i := 0; i < 3; i++ {
+		result[i] = (t[0][i] + t[1][i] + t[2][i]) / 3.0
+	}
+}
+
+func (t *Triangle) Plane(result *Plane) {
+	result.MakeFromPoints(&t[0], &t[1], &t[2])
+}
+
+// IsDegenerate reports whether the triangle is too thin to have a usable
+// normal: its height over the longest edge is tiny relative to that edge,
+// which makes the test independent of the triangle's scale
+func (t *Triangle) IsDegenerate() bool {
+	var edge0, edge1, edge2, cross Vector3
+	t.edges(&edge0, &edge1)
+	edge2.P3Sub(&t[2], &t[1])
+	cross.Cross(&edge0, &edge1)
+	longest := max(edge0.LengthSqr(), max(edge1.LengthSqr(), edge2.LengthSqr()))
+	if longest == 0.0 {
+		return true
+	}
+	// |cross| is the longest edge times the height to it
+	return cross.LengthSqr() <= g_EPSILON*g_EPSILON*longest*longest
+}
+
+// Barycentric finds the weights of each vertex for the point in the
+// triangle's plane closest to pnt.  It returns false for degenerate
+// triangles.
+func (t *Triangle) Barycentric(result *Vector3, pnt *Point3) bool {
+	var edge0, edge1, rel Vector3
+	t.edges(&edge0, &edge1)
+	rel.P3Sub(pnt, &t[0])
+	d00 := edge0.Dot(&edge0)
+	d01 := edge0.Dot(&edge1)
+	d11 := edge1.Dot(&edge1)
+	d20 := rel.Dot(&edge0)
+	d21 := rel.Dot(&edge1)
+	denom := d00*d11 - d01*d01
+	if denom <= g_EPSILON*g_EPSILON*d00*d11 {
+		return false
+	}
+	result[y] = (d11*d20 - d01*d21) / denom
+	result[z] = (d00*d21 - d01*d20) / denom
+	result[x] = 1.0 - result[y] - result[z]
+	return true
+}
+
+// ContainsPoint reports whether pnt, projected onto the triangle's plane,
+// falls within the triangle or on its edges
+func (t *Triangle) ContainsPoint(pnt *Point3) bool {
+	var bary Vector3
+	if !t.Barycentric(&bary, pnt) {
+		return false
+	}
+	return bary[x] >= -g_EPSILON && bary[y] >= -g_EPSILON && bary[z] >= -g_EPSILON
+}
+
+func (t *Triangle) ClosestPoint(result *Point3, pnt *Point3) {
+	var cp ClosestPoints
+	cp.PointTriangle(pnt, &t[0], &t[1], &t[2])
+	*result = cp.PointB
+}
+
+func (t *Triangle) IntersectRay(ray *Ray, hit *RayHit) bool {
+	return ray.IntersectTriangle(&t[0], &t[1], &t[2], hit)
+}
+
+// OverlapsAABB uses the separating axis test of Akenine-Möller, checking
+// the box face normals, the triangle normal and the nine cross products of
+// their edges
+func (t *Triangle) OverlapsAABB(box *AABB) bool {
+	var center Point3
+	var extent Vector3
+	var v [3]Vector3
+	var e [3]Vector3
+	box.Center(&center)
+	box.HalfExtents(&extent)
+	for i := 0; i < 3; i++ {
+		v[i].P3Sub(&t[i], &center)
+	}
+	e[0].Sub(&v[1], &v[0])
+	e[1].Sub(&v[2], &v[1])
+	e[2].Sub(&v[0], &v[2])
+
+	// edge cross box axis
+	var axis, unit Vector3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			unit = Vector3{}
+			unit[j] = 1.0
+			axis.Cross(&unit, &e[i])
+			p0 := v[0].Dot(&axis)
+			p1 := v[1].Dot(&axis)
+			p2 := v[2].Dot(&axis)
+			radius := extent[x]*abs(axis[x]) + extent[y]*abs(axis[y]) + extent[z]*abs(axis[z])
+			if min(p0, min(p1, p2)) > radius || max(p0, max(p1, p2)) < -radius {
+				return false
+			}
+		}
+	}
+
+	// box face normals
+	for i := 0; i < 3; i++ {
+		if min(v[0][i], min(v[1][i], v[2][i])) > extent[i] ||
+			max(v[0][i], max(v[1][i], v[2][i])) < -extent[i] {
+			return false
+		}
+	}
+
+	// triangle plane
+	var normal Vector3
+	normal.Cross(&e[0], &e[1])
+	dist := normal.Dot(&v[0])
+	radius := extent[x]*abs(normal[x]) + extent[y]*abs(normal[y]) + extent[z]*abs(normal[z])
+	return abs(dist) <= radius
+}
@@ -283,7 +283,7 @@ func (result *Vector3) Select(vec0, vec1 *Vector3, select1 int) {
 
 func (result *Vector3) Velocity(start, end *Vector3, elapsedTime float32) {
 	//change in position / elapsedTime
-	result.Sub(start, end)
+	result.Sub(end, start)
 	result[x] = result[x] / elapsedTime
 	result[y] = result[y] / elapsedTime
 	result[z] = result[z] / elapsedTime
@@ -0,0 +1,17 @@
+// Copyright 2013 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package vmath
+
+import (
+	"testing"
+)
+
+func TestVector3Velocity(t *testing.T) {
+	var vel Vector3
+	vel.Velocity(&Vector3{1, 2, 3}, &Vector3{3, 6, 3}, 2)
+	if vel != (Vector3{1, 2, 0}) {
+		t.Error("velocity", vel)
+	}
+}